@@ -1,41 +1,58 @@
 package v1
 
 import (
+	"chat-server/constant"
 	"chat-server/global"
-	"chat-server/middleware"
 	"chat-server/model/common"
+	"chat-server/model/request/chat"
 	"chat-server/service"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
-	"time"
+	"strconv"
 )
 
 type ChatApi struct{}
 
 // WebSocketHandler 处理WebSocket连接
 // @Summary 建立WebSocket连接
-// @Description 建立WebSocket连接以接收和发送实时消息
+// @Description 建立WebSocket连接以接收和发送实时消息，一个连接通过 subscribe/unsubscribe 帧订阅多个房间
 // @Tags 聊天
 // @Accept json
 // @Produce json
-// @Param room_id query string true "房间ID"
+// @Param room_id query string false "连接后直接订阅的房间ID"
+// @Param since_seq query int false "断线重连时 room_id 房间已收到的最后序号，传入时先补发之后的离线消息再推送实时消息"
+// @Param Sec-WebSocket-Protocol header string false "帧编码，chat.v1.json 或 chat.v1.msgpack，不传时使用JSON"
 // @Security BearerAuth
 // @Success 101 {string} string "Switching Protocols to WebSocket"
 // @Router /api/v1/chat/ws [get]
 func (chatApi *ChatApi) WebSocketHandler(c *gin.Context) {
-	// 获取要连接的房间id
+	// 连接后直接订阅的房间id，可选
 	roomId := c.Query("room_id")
-	if roomId == "" {
-		common.Result(c, common.INVALID_PARAMS)
-		return
+	// 断线重连的补发游标
+	var sinceSeq int64
+	if since := c.Query("since_seq"); since != "" {
+		var err error
+		if sinceSeq, err = strconv.ParseInt(since, 10, 64); err != nil || sinceSeq < 0 {
+			common.Result(c, common.INVALID_PARAMS)
+			return
+		}
 	}
 	// 获取userId
-	claims, exists := c.Get("claims")
-	if !exists {
+	userId, ok := getUserId(c)
+	if !ok {
 		common.Result(c, common.USER_NOT_FOUND)
 		return
 	}
-	userId := claims.(*jwt.Token).Claims.(*middleware.AccessToken).UserID
+	// 升级前校验房间状态和成员身份，私有房间只允许成员订阅
+	if roomId != "" {
+		if err := roomService.CheckRoomMember(userId, roomId); err != nil {
+			var serviceErr common.ServiceErr
+			if errors.As(err, &serviceErr) {
+				common.Result(c, serviceErr.GetResponseCode())
+			}
+			return
+		}
+	}
 	// 升级websocket连接
 	conn, err := global.CHAT_UPGRADER.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -45,19 +62,263 @@ func (chatApi *ChatApi) WebSocketHandler(c *gin.Context) {
 	}
 	global.CHAT_LOG.Info("WebSocketHandler 升级websocket连接成功")
 	// 创建客户端
-	client := &service.Client{
-		Conn:     conn,
-		UserId:   userId,
-		RoomId:   roomId,
-		Send:     make(chan *service.WebSocketMessage, 256),
-		LastPing: time.Now(),
-		Manager:  global.CHAT_WEBSOCKET_MANAGER.(*service.WebSocketManager),
-	}
+	client := service.NewClient(conn, userId, global.CHAT_WEBSOCKET_MANAGER.(*service.WebSocketManager))
 	// 注册客户端
 	client.Manager.Register <- client
+	// 兼容只连接一个房间的客户端，直接订阅连接时传入的房间，订阅失败时通过 error 帧通知客户端，连接保持
+	if roomId != "" {
+		if err := client.Manager.Subscribe(client, roomId, sinceSeq); err != nil {
+			global.CHAT_LOG.Warn("WebSocketHandler 订阅房间失败", "user_id", userId, "room_id", roomId, "err", err)
+			client.SendError(&service.WebSocketMessage{Type: constant.MessageTypeSubscribe, RoomId: roomId}, err)
+		}
+	}
 	// 启动读取协程
 	go client.ReadPump()
 	go client.WritePump()
 
 	//common.Result(c, common.SUCCESS, userId)
 }
+
+// SendDirectMessage godoc
+// @Summary      发送私聊消息
+// @Description  向指定用户发送一对一文本消息，首次发送时自动创建私聊房间
+// @Tags         聊天
+// @Accept       json
+// @Produce      json
+// @Param        request  body      chat.SendMessageRequest  true  "消息内容和接收者"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/chat/direct [post]
+func (chatApi *ChatApi) SendDirectMessage(c *gin.Context) {
+	var req chat.SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	message, err := chatService.SendDirectMessage(userId, req.ToUser, req.Content)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, message)
+}
+
+// EditMessage godoc
+// @Summary      编辑消息
+// @Description  编辑自己发送的文本或回复消息，超过编辑时限后不可编辑，原内容保存在编辑历史中
+// @Tags         聊天
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                   true  "消息ID"
+// @Param        request  body      chat.EditMessageRequest  true  "新的消息内容"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/chat/message/{id} [put]
+func (chatApi *ChatApi) EditMessage(c *gin.Context) {
+	var req chat.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	message, err := messageService.EditMessage(userId, c.Param("id"), req.Text)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, message)
+}
+
+// DeleteMessage godoc
+// @Summary      删除消息
+// @Description  删除自己发送的消息，消息保留为墓碑记录，内容被清空
+// @Tags         聊天
+// @Produce      json
+// @Param        id   path      string  true  "消息ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/chat/message/{id} [delete]
+func (chatApi *ChatApi) DeleteMessage(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := messageService.DeleteMessage(userId, c.Param("id")); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// AddReaction godoc
+// @Summary      添加表情回应
+// @Description  给房间内的消息添加表情回应，emoji 需要URL编码，返回该消息的表情回应统计
+// @Tags         聊天
+// @Produce      json
+// @Param        id     path      string  true  "消息ID"
+// @Param        emoji  path      string  true  "表情"
+// @Security     BearerAuth
+// @Success      200    {object}  common.Response
+// @Router       /api/v1/chat/message/{id}/reactions/{emoji} [put]
+func (chatApi *ChatApi) AddReaction(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	reactions, err := messageService.AddReaction(userId, c.Param("id"), c.Param("emoji"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, reactions)
+}
+
+// RemoveReaction godoc
+// @Summary      取消表情回应
+// @Description  取消自己对消息的表情回应，emoji 需要URL编码，返回该消息的表情回应统计
+// @Tags         聊天
+// @Produce      json
+// @Param        id     path      string  true  "消息ID"
+// @Param        emoji  path      string  true  "表情"
+// @Security     BearerAuth
+// @Success      200    {object}  common.Response
+// @Router       /api/v1/chat/message/{id}/reactions/{emoji} [delete]
+func (chatApi *ChatApi) RemoveReaction(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	reactions, err := messageService.RemoveReaction(userId, c.Param("id"), c.Param("emoji"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, reactions)
+}
+
+// ListThreadMessages godoc
+// @Summary      线程回复列表
+// @Description  分页查询消息线程的根消息和回复，回复按时间正序排列，默认从最早的回复开始
+// @Tags         聊天
+// @Produce      json
+// @Param        id      path   string  true   "线程根消息ID"
+// @Param        before  query  string  false  "向更早翻页的游标，消息id或毫秒时间戳"
+// @Param        after   query  string  false  "向更新翻页的游标，消息id或毫秒时间戳"
+// @Param        limit   query  int     false  "每页数量，默认50，最大100"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/chat/message/{id}/thread [get]
+func (chatApi *ChatApi) ListThreadMessages(c *gin.Context) {
+	var req chat.ListMessagesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	page, err := messageService.ListThreadMessages(userId, c.Param("id"), req.Before, req.After, req.Limit)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, page)
+}
+
+// FollowThread godoc
+// @Summary      关注线程
+// @Description  关注消息线程，线程有新回复时通过WebSocket收到 thread 通知
+// @Tags         聊天
+// @Produce      json
+// @Param        id   path      string  true  "线程根消息ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/chat/message/{id}/follow [put]
+func (chatApi *ChatApi) FollowThread(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := messageService.FollowThread(userId, c.Param("id"), true); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// UnfollowThread godoc
+// @Summary      取消关注线程
+// @Description  取消关注消息线程，不再收到该线程的 thread 通知
+// @Tags         聊天
+// @Produce      json
+// @Param        id   path      string  true  "线程根消息ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/chat/message/{id}/follow [delete]
+func (chatApi *ChatApi) UnfollowThread(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := messageService.FollowThread(userId, c.Param("id"), false); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
@@ -1,6 +1,12 @@
 package v1
 
-import "chat-server/service"
+import (
+	"chat-server/middleware"
+	"chat-server/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
 
 var ApiGroupApp = new(ApiGroup)
 
@@ -8,11 +14,27 @@ type ApiGroup struct {
 	UserApi
 	ChatApi
 	TokenApi
+	RoomApi
+	SearchApi
+	PresenceApi
 }
 
 var (
-	chatService   = service.ServiceGroupApp.ChatService
-	userService   = service.ServiceGroupApp.UserService
-	mongoToEsSync = service.ServiceGroupApp.MongoToEsSync
-	tokenService  = service.ServiceGroupApp.TokenService
+	chatService     = service.ServiceGroupApp.ChatService
+	userService     = service.ServiceGroupApp.UserService
+	mongoToEsSync   = service.ServiceGroupApp.MongoToEsSync
+	tokenService    = service.ServiceGroupApp.TokenService
+	roomService     = service.ServiceGroupApp.RoomService
+	messageService  = service.ServiceGroupApp.MessageService
+	searchService   = service.ServiceGroupApp.SearchService
+	presenceService = service.ServiceGroupApp.PresenceService
 )
+
+// getUserId 从JWT中间件写入的claims中获取当前用户id
+func getUserId(c *gin.Context) (string, bool) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return "", false
+	}
+	return claims.(*jwt.Token).Claims.(*middleware.AccessToken).UserID, true
+}
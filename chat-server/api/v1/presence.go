@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"chat-server/model/common"
+	"chat-server/model/request/presence"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PresenceApi struct{}
+
+// ListRoomOnline godoc
+// @Summary      房间在线用户
+// @Description  查询房间内在线的用户，只有房间成员可以查询
+// @Tags         Presence
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/presence/room/{id} [get]
+func (presenceApi *PresenceApi) ListRoomOnline(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	online, err := presenceService.ListRoomOnline(userId, c.Param("id"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, online)
+}
+
+// GetUsersPresence godoc
+// @Summary      用户在线状态
+// @Description  批量查询用户的全局在线状态，用户在任意房间有连接即为在线，离线时返回最后在线时间
+// @Tags         Presence
+// @Produce      json
+// @Param        user_ids  query  string  true  "逗号分隔的用户ID，最多100个"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/presence/users [get]
+func (presenceApi *PresenceApi) GetUsersPresence(c *gin.Context) {
+	var req presence.QueryPresenceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	if _, ok := getUserId(c); !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	var userIds []string
+	for _, userId := range strings.Split(req.UserIds, ",") {
+		if userId = strings.TrimSpace(userId); userId != "" {
+			userIds = append(userIds, userId)
+		}
+	}
+	result, err := presenceService.GetUsersPresence(userIds)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, result)
+}
@@ -0,0 +1,609 @@
+package v1
+
+import (
+	"chat-server/model/common"
+	"chat-server/model/request/chat"
+	"chat-server/model/request/room"
+	"errors"
+	"github.com/gin-gonic/gin"
+)
+
+type RoomApi struct{}
+
+// CreateRoom godoc
+// @Summary      创建房间
+// @Description  创建新的聊天房间，创建者自动成为房间成员
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        request  body      room.CreateRoomRequest  true  "房间信息"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/room [post]
+func (roomApi *RoomApi) CreateRoom(c *gin.Context) {
+	var req room.CreateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	createdRoom, err := roomService.CreateRoom(userId, req.RoomName, req.IsPrivate)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, createdRoom)
+}
+
+// GetRoom godoc
+// @Summary      获取房间信息
+// @Description  获取房间详情，私有房间只有成员可以查看
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id} [get]
+func (roomApi *RoomApi) GetRoom(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	roomInfo, err := roomService.GetRoom(userId, c.Param("id"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, roomInfo)
+}
+
+// ListMyRooms godoc
+// @Summary      我的房间列表
+// @Description  获取当前用户加入的所有房间
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/mine [get]
+func (roomApi *RoomApi) ListMyRooms(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	rooms, err := roomService.ListMyRooms(userId)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, rooms)
+}
+
+// UpdateRoom godoc
+// @Summary      修改房间信息
+// @Description  修改房间名称、私有属性或公告属性，房主和管理员可以操作
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                  true  "房间ID"
+// @Param        request  body      room.UpdateRoomRequest  true  "要修改的房间信息"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/room/{id} [put]
+func (roomApi *RoomApi) UpdateRoom(c *gin.Context) {
+	var req room.UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	updatedRoom, err := roomService.UpdateRoom(userId, c.Param("id"), req.RoomName, req.IsPrivate, req.IsAnnouncement)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, updatedRoom)
+}
+
+// DeleteRoom godoc
+// @Summary      删除房间
+// @Description  软删除房间，只有房主可以操作
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id} [delete]
+func (roomApi *RoomApi) DeleteRoom(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := roomService.DeleteRoom(userId, c.Param("id")); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// ListMembers godoc
+// @Summary      房间成员列表
+// @Description  获取房间的所有成员，只有成员可以查看
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/members [get]
+func (roomApi *RoomApi) ListMembers(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	members, err := roomService.ListMembers(userId, c.Param("id"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, members)
+}
+
+// JoinRoom godoc
+// @Summary      加入房间
+// @Description  公开房间直接加入；私有房间提交加入申请，等待房主或管理员审核
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/join [post]
+func (roomApi *RoomApi) JoinRoom(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	joinRequest, err := roomService.JoinRoom(userId, c.Param("id"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, map[string]interface{}{
+		"joined":       joinRequest == nil,
+		"join_request": joinRequest,
+	})
+}
+
+// LeaveRoom godoc
+// @Summary      退出房间
+// @Description  退出房间并断开该房间的连接，房主不能退出
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/leave [post]
+func (roomApi *RoomApi) LeaveRoom(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := roomService.LeaveRoom(userId, c.Param("id")); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// KickMember godoc
+// @Summary      移出成员
+// @Description  将成员移出房间并断开其连接，房主和管理员可以移出角色比自己低的成员
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string  true  "房间ID"
+// @Param        user_id  path  string  true  "被移出的用户ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/members/{user_id} [delete]
+func (roomApi *RoomApi) KickMember(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := roomService.KickMember(userId, c.Param("id"), c.Param("user_id")); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// CreateInvite godoc
+// @Summary      创建邀请链接
+// @Description  创建带有效期和使用次数限制的邀请码，房主和管理员可以操作
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                    true  "房间ID"
+// @Param        request  body      room.CreateInviteRequest  true  "邀请限制"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/room/{id}/invites [post]
+func (roomApi *RoomApi) CreateInvite(c *gin.Context) {
+	var req room.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	invite, err := roomService.CreateInvite(userId, c.Param("id"), req.ExpiresIn, req.MaxUses)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, invite)
+}
+
+// RevokeInvite godoc
+// @Summary      撤销邀请链接
+// @Description  撤销邀请码，房主和管理员可以操作
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id         path  string  true  "房间ID"
+// @Param        invite_id  path  string  true  "邀请ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/invites/{invite_id} [delete]
+func (roomApi *RoomApi) RevokeInvite(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := roomService.RevokeInvite(userId, c.Param("id"), c.Param("invite_id")); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// JoinByInvite godoc
+// @Summary      通过邀请码加入房间
+// @Description  使用有效的邀请码加入房间，私有房间无需审核
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        code  path  string  true  "邀请码"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/invite/{code}/join [post]
+func (roomApi *RoomApi) JoinByInvite(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	joinedRoom, err := roomService.JoinByInvite(userId, c.Param("code"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, joinedRoom)
+}
+
+// ListJoinRequests godoc
+// @Summary      加入申请列表
+// @Description  获取私有房间待审核的加入申请，房主和管理员可以查看
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id  path  string  true  "房间ID"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/joinRequests [get]
+func (roomApi *RoomApi) ListJoinRequests(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	joinRequests, err := roomService.ListJoinRequests(userId, c.Param("id"))
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, joinRequests)
+}
+
+// HandleJoinRequest godoc
+// @Summary      审核加入申请
+// @Description  通过或拒绝加入申请，房主和管理员可以操作
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id          path      string                  true  "房间ID"
+// @Param        request_id  path      string                  true  "申请ID"
+// @Param        request     body      room.HandleJoinRequest  true  "审核结果"
+// @Security     BearerAuth
+// @Success      200         {object}  common.Response
+// @Router       /api/v1/room/{id}/joinRequests/{request_id} [put]
+func (roomApi *RoomApi) HandleJoinRequest(c *gin.Context) {
+	var req room.HandleJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := roomService.HandleJoinRequest(userId, c.Param("id"), c.Param("request_id"), *req.Approve); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// UpdateMemberRole godoc
+// @Summary      修改成员角色
+// @Description  将成员设置为管理员、普通成员或只读成员，只有房主可以操作
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                        true  "房间ID"
+// @Param        user_id  path      string                        true  "成员用户ID"
+// @Param        request  body      room.UpdateMemberRoleRequest  true  "新角色"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/room/{id}/members/{user_id}/role [put]
+func (roomApi *RoomApi) UpdateMemberRole(c *gin.Context) {
+	var req room.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	if err := roomService.SetMemberRole(userId, c.Param("id"), c.Param("user_id"), req.Role); err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS)
+}
+
+// ListMessages godoc
+// @Summary      房间历史消息
+// @Description  游标分页查询房间历史消息(合并用户消息和系统消息)，只有成员可以查看
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id      path   string  true   "房间ID"
+// @Param        before  query  string  false  "向更早翻页的游标，消息id或毫秒时间戳"
+// @Param        after   query  string  false  "向更新翻页的游标，消息id或毫秒时间戳"
+// @Param        limit   query  int     false  "每页数量，默认50，最大100"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/messages [get]
+func (roomApi *RoomApi) ListMessages(c *gin.Context) {
+	var req chat.ListMessagesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	page, err := messageService.ListRoomMessages(userId, c.Param("id"), req.Before, req.After, req.Limit)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, page)
+}
+
+// MarkRead godoc
+// @Summary      标记已读
+// @Description  把当前用户在房间内的已读位置推进到指定消息，已读位置只前进不后退，推进时向房间广播 receipt 事件
+// @Tags         Room
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                true  "房间ID"
+// @Param        request  body      room.MarkReadRequest  true  "最后已读的消息ID"
+// @Security     BearerAuth
+// @Success      200      {object}  common.Response
+// @Router       /api/v1/room/{id}/read [post]
+func (roomApi *RoomApi) MarkRead(c *gin.Context) {
+	var req room.MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	cursor, err := messageService.MarkRead(userId, c.Param("id"), req.MessageId)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, cursor)
+}
+
+// ListUnreadCounts godoc
+// @Summary      房间未读数
+// @Description  获取当前用户加入的每个房间的未读数和已读位置，未读数最多统计到999
+// @Tags         Room
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/unread [get]
+func (roomApi *RoomApi) ListUnreadCounts(c *gin.Context) {
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	unreads, err := messageService.ListUnreadCounts(userId)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, unreads)
+}
+
+// ResyncMessages godoc
+// @Summary      按序号补发消息
+// @Description  查询房间内序号在 from_seq 到 to_seq 之间的消息，客户端发现序号不连续时调用，单次最多200条
+// @Tags         Room
+// @Produce      json
+// @Param        id        path   string  true   "房间ID"
+// @Param        from_seq  query  int     true   "起始序号"
+// @Param        to_seq    query  int     false  "结束序号，不传时补发到最新"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/room/{id}/resync [get]
+func (roomApi *RoomApi) ResyncMessages(c *gin.Context) {
+	var req chat.ResyncMessagesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	page, err := messageService.ResyncMessages(userId, c.Param("id"), req.FromSeq, req.ToSeq)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, page)
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"chat-server/model/common"
+	"chat-server/model/request/chat"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchApi struct{}
+
+// SearchMessages godoc
+// @Summary      搜索消息
+// @Description  全文搜索用户消息(文本、回复文本和附件名称)，只返回当前用户所在房间的消息
+// @Tags         Search
+// @Accept       json
+// @Produce      json
+// @Param        q           query  string  true   "搜索关键词"
+// @Param        room_id     query  string  false  "房间ID"
+// @Param        sender_id   query  string  false  "发送者ID"
+// @Param        type        query  string  false  "消息类型"
+// @Param        start_time  query  int     false  "开始时间，毫秒时间戳"
+// @Param        end_time    query  int     false  "结束时间，毫秒时间戳"
+// @Param        page        query  int     false  "页码，从1开始，页码乘每页数量不能超过10000"
+// @Param        page_size   query  int     false  "每页数量，默认20，最大50"
+// @Security     BearerAuth
+// @Success      200  {object}  common.Response
+// @Router       /api/v1/search/messages [get]
+func (searchApi *SearchApi) SearchMessages(c *gin.Context) {
+	var req chat.SearchMessagesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.Result(c, common.INVALID_PARAMS)
+		return
+	}
+	userId, ok := getUserId(c)
+	if !ok {
+		common.Result(c, common.USER_NOT_FOUND)
+		return
+	}
+
+	result, err := searchService.SearchMessages(userId, &req)
+	if err != nil {
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) {
+			common.Result(c, serviceErr.GetResponseCode())
+		}
+		return
+	}
+
+	common.Result(c, common.SUCCESS, result)
+}
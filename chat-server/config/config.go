@@ -8,6 +8,9 @@ type AppConfig struct {
 	Redis         Redis          `mapstructure:"redis" yaml:"redis"`
 	Logger        Logger         `mapstructure:"logger" yaml:"logger"`
 	MongoEsSync   []MongoEsSync  `mapstructure:"mongo_es_sync" yaml:"mongo_es_sync"`
+	MongoEsBulk   MongoEsBulk    `mapstructure:"mongo_es_bulk" yaml:"mongo_es_bulk"`
 	DBSchema      DBSchemaConfig `mapstructure:"db_schema" yaml:"db_schema"` // 新增字段
 	JWT           JWT            `mapstructure:"jwt" yaml:"jwt"`             // JWT配置
+	Message       Message        `mapstructure:"message" yaml:"message"`     // 消息配置
+	WebSocket     WebSocket      `mapstructure:"websocket" yaml:"websocket"` // WebSocket配置
 }
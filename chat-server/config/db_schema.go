@@ -1,5 +1,7 @@
 package config
 
+import "go.mongodb.org/mongo-driver/v2/bson"
+
 type DBSchemaConfig struct {
 	MySQL         *MySQLSchemaConfig                `mapstructure:"mysql" yaml:"mysql"`
 	MongoDB       *MongoDBClusterSchemaConfig       `mapstructure:"mongodb" yaml:"mongodb"`
@@ -8,7 +10,7 @@ type DBSchemaConfig struct {
 
 // MySQLSchemaConfig 定义MySQL Schema配置
 type MySQLSchemaConfig struct {
-	ScriptFile string `mapstructure:"script_file" yaml:"script_file"` // 指向SQL脚本文件
+	MigrationsDir string `mapstructure:"migrations_dir" yaml:"migrations_dir"` // 迁移目录，文件名为 版本号_名称.up.sql / 版本号_名称.down.sql
 }
 
 // MongoDBCollectionSchema 定义单个MongoDB集合的Schema配置
@@ -25,14 +27,16 @@ type MongoDBClusterSchemaConfig struct {
 
 // MongoDBIndexSchema 定义单个MongoDB索引的配置 (用于解析JSON文件中的索引)
 type MongoDBIndexSchema struct {
-	Keys    map[string]interface{} `json:"keys"`
-	Options map[string]interface{} `mapstructure:"options" yaml:"options"`
+	Keys    bson.D                 `bson:"keys" json:"keys"` // 有序的索引字段，保证复合索引的字段顺序与文件一致
+	Options map[string]interface{} `bson:"options" mapstructure:"options" yaml:"options"`
 }
 
 // ElasticsearchIndexSchema 定义单个Elasticsearch索引的配置
+// Name 是别名，实际索引名为 Name_v版本号
 type ElasticsearchIndexSchema struct {
 	Name        string `mapstructure:"name" yaml:"name"`
 	RequestFile string `mapstructure:"request_file" yaml:"request_file"` // 指向完整的JSON请求体文件
+	AutoMigrate bool   `mapstructure:"auto_migrate" yaml:"auto_migrate"` // 映射与文件不一致时自动重建索引并切换别名
 }
 
 // ElasticsearchClusterSchemaConfig 定义整个Elasticsearch集群的Schema配置
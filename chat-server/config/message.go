@@ -0,0 +1,7 @@
+package config
+
+type Message struct {
+	EditWindow   int `mapstructure:"edit_window" yaml:"edit_window"`     // 发送后可编辑的时间（秒），0为不限制
+	DeleteWindow int `mapstructure:"delete_window" yaml:"delete_window"` // 发送后可删除的时间（秒），0为不限制
+	MaxReactions int `mapstructure:"max_reactions" yaml:"max_reactions"` // 每条消息最多的表情种类，0为不限制
+}
@@ -4,3 +4,13 @@ type MongoEsSync struct {
 	MongoCollection string `mapstructure:"mongo_collection" yaml:"mongo_collection"`
 	EsIndex         string `mapstructure:"es_index" yaml:"es_index"`
 }
+
+// MongoEsBulk Mongo-ES 同步批量写入配置
+type MongoEsBulk struct {
+	BatchSize            int    `mapstructure:"batch_size" yaml:"batch_size"`                         // 单批最大文档数
+	BatchBytes           int    `mapstructure:"batch_bytes" yaml:"batch_bytes"`                       // 单批最大字节数
+	FlushInterval        int    `mapstructure:"flush_interval" yaml:"flush_interval"`                 // 最长刷新间隔（毫秒）
+	MaxRetries           int    `mapstructure:"max_retries" yaml:"max_retries"`                       // 429/5xx 最大重试次数
+	RetryBackoff         int    `mapstructure:"retry_backoff" yaml:"retry_backoff"`                   // 首次重试等待时间（毫秒），之后指数增长
+	DeadLetterCollection string `mapstructure:"dead_letter_collection" yaml:"dead_letter_collection"` // 死信集合
+}
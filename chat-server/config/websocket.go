@@ -0,0 +1,5 @@
+package config
+
+type WebSocket struct {
+	NodeId string `mapstructure:"node_id" yaml:"node_id"` // 节点id，多节点部署时必须唯一，为空时使用主机名加随机后缀
+}
@@ -1,20 +1,45 @@
 package constant
 
 const (
-	MessageTypeText    = "text"    // 文本消息
-	MessageTypeImage   = "image"   // 图片消息
-	MessageTypeFile    = "file"    // 文件消息
-	MessageTypeVoice   = "voice"   // 语音消息
-	MessageTypeVideo   = "video"   // 视频消息
-	MessageTypeReply   = "reply"   // 回复消息
-	MessageTypeJoin    = "join"    // 加入房间
-	MessageTypeLeave   = "leave"   // 离开房间
-	MessageTypeSystem  = "system"  // 系统消息
-	MessageTypeTyping  = "typing"  // 正在输入
-	MessageTypeReceipt = "receipt" // 已读回执
-
-	JoinMessageContent  = "用户已加入房间"
-	LeaveMessageContent = "用户已离开房间"
+	MessageTypeText     = "text"     // 文本消息
+	MessageTypeImage    = "image"    // 图片消息
+	MessageTypeFile     = "file"     // 文件消息
+	MessageTypeVoice    = "voice"    // 语音消息
+	MessageTypeVideo    = "video"    // 视频消息
+	MessageTypeReply    = "reply"    // 回复消息
+	MessageTypeJoin     = "join"     // 加入房间
+	MessageTypeLeave    = "leave"    // 离开房间
+	MessageTypeSystem   = "system"   // 系统消息
+	MessageTypeTyping   = "typing"   // 正在输入
+	MessageTypeReceipt  = "receipt"  // 已读回执
+	MessageTypeEdit     = "edit"     // 编辑消息
+	MessageTypeDelete   = "delete"   // 删除消息
+	MessageTypeReaction = "reaction" // 表情回应
+	MessageTypeThread   = "thread"   // 关注的线程有新回复
+	MessageTypeAck      = "ack"      // 请求处理成功的确认，用户消息在持久化后确认
+	MessageTypeError    = "error"    // 请求处理失败，content 中 code 为错误码
+	MessageTypeBatch    = "batch"    // 多条消息合并发送，content 为消息数组
+	MessageTypeResync   = "resync"   // 按序号补发缺失的消息
+	MessageTypeCatchUp  = "catchup"  // 离线消息补发完成，之后为实时消息
+	MessageTypePresence = "presence" // 用户在房间内上线或离线
+
+	// 单个连接订阅多个房间，客户端发送订阅和取消订阅帧，服务端回复当前的订阅状态
+	MessageTypeSubscribe   = "subscribe"   // 订阅房间
+	MessageTypeUnsubscribe = "unsubscribe" // 取消订阅房间
+
+	ReactionActionAdd    = "add"    // 添加表情回应
+	ReactionActionRemove = "remove" // 取消表情回应
+
+	TypingActionStart = "start" // 开始输入
+	TypingActionStop  = "stop"  // 停止输入
+
+	PresenceStatusOnline  = "online"  // 在线
+	PresenceStatusOffline = "offline" // 离线
+
+	JoinMessageContent       = "用户已加入房间"
+	LeaveMessageContent      = "用户已离开房间"
+	KickMessageContent       = "用户已被移出房间"
+	DeleteRoomMessageContent = "房间已被删除"
 )
 
 var UserMessageType = map[string]bool{
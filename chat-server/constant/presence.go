@@ -0,0 +1,13 @@
+package constant
+
+import "time"
+
+const (
+	PresenceRoomPrefix    = "presence:room"      // 房间内在线的用户，zset key 为 presence:room:房间id，score 为过期时间
+	PresenceConnPrefix    = "presence:conn"      // 用户在房间内的连接，zset key 为 presence:conn:房间id:用户id
+	PresenceUserPrefix    = "presence:user"      // 用户在所有房间的连接，zset key 为 presence:user:用户id
+	PresenceLastSeenKey   = "presence:last_seen" // 用户最后在线时间，hash field 为用户id
+	PresenceExpire        = 90 * time.Second     // 连接没有心跳后视为离线的时间，心跳随 pong 刷新
+	PresenceSweepInterval = 30 * time.Second     // 清理房间内过期连接的间隔，节点宕机后由其他节点清理
+	MaxPresenceQueryCount = 100                  // 单次查询在线状态的最大用户数
+)
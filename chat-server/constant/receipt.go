@@ -0,0 +1,9 @@
+package constant
+
+import "time"
+
+const (
+	ReadCursorPrefix = "read_cursor" // 已读位置缓存，hash key 为 read_cursor:用户id，field 为房间id
+	ReadCursorExpire = 7 * 24 * time.Hour
+	MaxUnreadCount   = 999 // 未读数统计上限，超过时客户端显示 999+
+)
@@ -0,0 +1,27 @@
+package constant
+
+const (
+	JoinRequestStatusPending  = "pending"  // 待审核
+	JoinRequestStatusApproved = "approved" // 已通过
+	JoinRequestStatusRejected = "rejected" // 已拒绝
+)
+
+// 房间成员角色
+const (
+	RoomRoleOwner    = "owner"    // 房主
+	RoomRoleAdmin    = "admin"    // 管理员
+	RoomRoleMember   = "member"   // 普通成员
+	RoomRoleReadOnly = "readonly" // 只读成员，不能发言
+)
+
+// 房间权限
+const (
+	RoomPermissionSendMessage        = "send_message"         // 发送消息
+	RoomPermissionPostAnnouncement   = "post_announcement"    // 在公告房间发送消息
+	RoomPermissionUpdateRoom         = "update_room"          // 修改房间信息
+	RoomPermissionDeleteRoom         = "delete_room"          // 删除房间
+	RoomPermissionKickMember         = "kick_member"          // 移出成员
+	RoomPermissionManageInvites      = "manage_invites"       // 管理邀请链接
+	RoomPermissionHandleJoinRequests = "handle_join_requests" // 审核加入申请
+	RoomPermissionManageRoles        = "manage_roles"         // 修改成员角色
+)
@@ -0,0 +1,6 @@
+package constant
+
+const (
+	// MongoEsResumeTokenPrefix Mongo-ES 同步的 Change Stream 恢复令牌，key 为 前缀:集合:索引
+	MongoEsResumeTokenPrefix = "mongo_es_sync:resume_token"
+)
@@ -3,5 +3,26 @@ package constant
 import "time"
 
 const (
-	OnlineUserExpire = 24 * time.Hour
+	TypingExpire      = 5 * time.Second // 正在输入状态没有刷新时自动结束的时间
+	TypingMinInterval = time.Second     // 同一连接转发正在输入事件的最小间隔
+
+	RoomSeqPrefix            = "room_seq"        // 房间消息序号，key 为 room_seq:房间id
+	MessageIdempotencyPrefix = "msg_idempotency" // 客户端消息幂等键，key 为 msg_idempotency:用户id:client_msg_id
+	MessageIdempotencyExpire = 24 * time.Hour
+	MaxResyncCount           = 200 // 单次补发的最大消息数
+
+	MaxCatchUpCount      = 1000                   // 重连时补发的最大离线消息数，超过时客户端通过 resync 继续补发
+	CatchUpRetryInterval = 100 * time.Millisecond // 等待异步持久化的消息写入 MongoDB 的间隔
+	CatchUpRetries       = 10
+
+	RoomChannelPrefix = "ws:room" // 节点间转发房间消息的 pub/sub 频道，ws:room:房间id
+	UserChannelPrefix = "ws:user" // 节点间转发用户消息的 pub/sub 频道，ws:user:用户id
+
+	MaxRoomSubscriptions = 100 // 单个连接最多订阅的房间数
+
+	ProtocolVersion = 1 // WebSocket 协议版本，服务端发送的帧都带有版本，客户端不传时视为当前版本
+
+	// 通过 Sec-WebSocket-Protocol 协商的编码，客户端不传子协议时使用 JSON
+	SubprotocolJSON    = "chat.v1.json"    // JSON 文本帧
+	SubprotocolMsgpack = "chat.v1.msgpack" // MessagePack 二进制帧
 )
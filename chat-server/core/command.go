@@ -0,0 +1,85 @@
+package core
+
+import (
+	"chat-server/global"
+	"chat-server/initialize"
+	"chat-server/service"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RunCommand 执行命令行子命令，用于运维操作，不启动HTTP服务
+func RunCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "replay-dead-letters":
+		// 重放 Mongo-ES 同步死信
+		replayed, failed, err := service.ServiceGroupApp.ReplayDeadLetters(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("死信重放完成，成功 %d 条，失败 %d 条\n", replayed, failed)
+		return nil
+	case "reindex":
+		// 从 MongoDB 重建 ES 索引并切换别名，用法: reindex [--delete-old] [es_index...]
+		var indices []string
+		deleteOld := false
+		for _, arg := range args[1:] {
+			if arg == "--delete-old" {
+				deleteOld = true
+				continue
+			}
+			indices = append(indices, arg)
+		}
+		return service.ServiceGroupApp.ReindexAll(ctx, indices, deleteOld)
+	case "migrate":
+		// MySQL 迁移，用法: migrate [up [n]|down [n]|status]
+		return runMigrateCommand(ctx, args[1:])
+	default:
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+// runMigrateCommand 执行 MySQL 迁移子命令，up 默认执行全部，down 默认回滚一个
+func runMigrateCommand(ctx context.Context, args []string) error {
+	if global.CHAT_CONFIG.DBSchema.MySQL == nil {
+		return errors.New("未配置 db_schema.mysql")
+	}
+	dir := global.CHAT_CONFIG.DBSchema.MySQL.MigrationsDir
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("无效的迁移数量: %s", args[1])
+		}
+		steps = n
+	}
+
+	switch action {
+	case "up":
+		return initialize.MigrateMySQL(ctx, dir, steps)
+	case "down":
+		return initialize.RollbackMySQL(ctx, dir, steps)
+	case "status":
+		statuses, err := initialize.MySQLMigrationStatus(ctx, dir)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "未执行"
+			if status.Applied {
+				state = "已执行 " + time.UnixMilli(status.AppliedAt).Format(time.DateTime)
+			}
+			fmt.Printf("%06d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的迁移操作: %s", action)
+	}
+}
@@ -2,8 +2,9 @@ package initialize
 
 import (
 	"chat-server/global"
+	"chat-server/service"
+	"chat-server/utils"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -23,7 +24,7 @@ func InitDatabaseSchemas(ctx context.Context, schemaCfg config.DBSchemaConfig) e
 
 	// MySQL Schema Initialization
 	if schemaCfg.MySQL != nil { // <-- 使用传入的 schemaCfg
-		if err := initMySQLSchemaFromFile(ctx, schemaCfg.MySQL.ScriptFile); err != nil { // <-- 使用传入的 schemaCfg
+		if err := initMySQLSchema(ctx, schemaCfg.MySQL.MigrationsDir); err != nil { // <-- 使用传入的 schemaCfg
 			return fmt.Errorf("初始化 MySQL 结构失败: %w", err)
 		}
 	}
@@ -46,55 +47,18 @@ func InitDatabaseSchemas(ctx context.Context, schemaCfg config.DBSchemaConfig) e
 	return nil
 }
 
-// initMySQLSchemaFromFile 从SQL文件执行MySQL Schema初始化
-func initMySQLSchemaFromFile(ctx context.Context, scriptPath string) error {
+// initMySQLSchema 执行迁移目录中所有未执行的 MySQL 迁移
+func initMySQLSchema(ctx context.Context, migrationsDir string) error {
 	if global.CHAT_MYSQL == nil { // 使用全局变量
 		global.CHAT_LOG.Warn("MySQL 客户端未初始化，跳过 MySQL Schema引导。")
 		return nil
 	}
-	if scriptPath == "" {
-		global.CHAT_LOG.Info("MySQL Schema脚本路径未配置，跳过MySQL Schema初始化。")
+	if migrationsDir == "" {
+		global.CHAT_LOG.Info("MySQL 迁移目录未配置，跳过MySQL Schema初始化。")
 		return nil
 	}
-	global.CHAT_LOG.Info(fmt.Sprintf("开始执行 MySQL Schema脚本: %s", scriptPath))
-
-	sqlBytes, err := os.ReadFile(scriptPath)
-	if err != nil {
-		global.CHAT_LOG.Error(fmt.Sprintf("读取 MySQL Schema文件 '%s' 失败: %w", scriptPath, err))
-		return err
-	}
-	sqlContent := string(sqlBytes)
-
-	sqls := strings.Split(sqlContent, ";")
-
-	tx := global.CHAT_MYSQL.WithContext(ctx).Begin()
-	if tx.Error != nil {
-		global.CHAT_LOG.Error(fmt.Sprintf("开启MySQL事务失败: %w", tx.Error))
-		return tx.Error
-	}
-
-	for _, sql := range sqls {
-		sql = strings.TrimSpace(sql)
-		if sql == "" {
-			continue
-		}
-		if strings.HasPrefix(sql, "--") || strings.HasPrefix(sql, "#") {
-			continue
-		}
-		if err := tx.Exec(sql).Error; err != nil {
-			tx.Rollback()
-			global.CHAT_LOG.Error(fmt.Sprintf("执行 MySQL SQL语句失败: %w\nSQL: %s", err, sql))
-			return err
-		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		global.CHAT_LOG.Error(fmt.Sprintf("提交MySQL事务失败: %w", err))
-		return err
-	}
-
-	global.CHAT_LOG.Info("MySQL Schema脚本执行成功。")
-	return nil
+	global.CHAT_LOG.Info(fmt.Sprintf("开始执行 MySQL 迁移: %s", migrationsDir))
+	return MigrateMySQL(ctx, migrationsDir, 0)
 }
 
 // initMongoDBSchema handles MongoDB collection schema initialization (indexes and validation).
@@ -110,36 +74,54 @@ func initMongoDBSchema(ctx context.Context, cfg *config.MongoDBClusterSchemaConf
 		global.CHAT_LOG.Info(fmt.Sprintf("开始处理 MongoDB 集合 '%s' 的Schema...", collectionCfg.Name))
 		collection := db.Collection(collectionCfg.Name)
 
-		// --- 1. 处理索引文件 ---
+		// --- 1. 读取 Schema Validation 命令文件，索引字段校验需要用到其中的 $jsonSchema ---
+		var commandDoc bson.D
+		var jsonSchema bson.Raw
+		if collectionCfg.ValidatorCommandFile != "" {
+			commandBytes, err := os.ReadFile(collectionCfg.ValidatorCommandFile)
+			if err != nil {
+				return fmt.Errorf("读取 MongoDB Schema Validation 文件 '%s' 失败: %w", collectionCfg.ValidatorCommandFile, err)
+			}
+			if err := bson.UnmarshalExtJSON(commandBytes, true, &commandDoc); err != nil {
+				return fmt.Errorf("解析 MongoDB Schema Validation 命令文件 '%s' (JSON) 失败: %w", collectionCfg.ValidatorCommandFile, err)
+			}
+			jsonSchema, err = lookupJSONSchema(commandDoc)
+			if err != nil {
+				return fmt.Errorf("MongoDB Schema Validation 命令文件 '%s' 缺少 validator.$jsonSchema: %w", collectionCfg.ValidatorCommandFile, err)
+			}
+		}
+
+		// --- 2. 处理索引文件 ---
 		if collectionCfg.IndexFile != "" {
 			global.CHAT_LOG.Info(fmt.Sprintf("检查集合 '%s' 的索引...", collectionCfg.Name))
 			indexBytes, err := os.ReadFile(collectionCfg.IndexFile)
 			if err != nil {
 				return fmt.Errorf("读取 MongoDB 索引文件 '%s' 失败: %w", collectionCfg.IndexFile, err)
 			}
+			// 使用 Extended JSON 解析，保证复合索引的字段顺序与文件一致
 			var indexDefs []config.MongoDBIndexSchema // <-- 使用 config.MongoDBIndexSchema
-			if err := json.Unmarshal(indexBytes, &indexDefs); err != nil {
+			if err := bson.UnmarshalExtJSON(indexBytes, false, &indexDefs); err != nil {
 				return fmt.Errorf("解析 MongoDB 索引文件 '%s' (JSON) 失败: %w", collectionCfg.IndexFile, err)
 			}
 
-			var indexModels []mongo.IndexModel
-			for _, indexCfg := range indexDefs {
-				keysDoc := bson.D{} // 重新初始化一个有序的 BSON 文档
-				if indexCfg.Options["name"] == "room_timestamp" {
-					keysDoc = append(keysDoc, bson.E{Key: "room_id", Value: indexCfg.Keys["room_id"]})
-					keysDoc = append(keysDoc, bson.E{Key: "timestamp", Value: indexCfg.Keys["timestamp"]})
-				} else if indexCfg.Options["name"] == "_id_" {
-					keysDoc = append(keysDoc, bson.E{Key: "_id", Value: indexCfg.Keys["_id"]})
-				} else if indexCfg.Options["name"] == "timestamp_desc" {
-					keysDoc = append(keysDoc, bson.E{Key: "timestamp", Value: indexCfg.Keys["timestamp"]})
-				} else {
-					// 对于其他通用索引，或者不关心顺序的单字段索引，可以继续遍历
-					for k, v := range indexCfg.Keys {
-						keysDoc = append(keysDoc, bson.E{Key: k, Value: v})
-					}
+			// 索引字段必须在 $jsonSchema 中声明，避免索引建在不存在的字段上导致查询全表扫描
+			if jsonSchema != nil {
+				if err := validateIndexFields(indexDefs, jsonSchema); err != nil {
+					return fmt.Errorf("集合 '%s' 的索引文件 '%s' 校验失败: %w", collectionCfg.Name, collectionCfg.IndexFile, err)
 				}
+			} else {
+				global.CHAT_LOG.Warn(fmt.Sprintf("集合 '%s' 未配置 Schema Validation 文件，跳过索引字段校验", collectionCfg.Name))
+			}
+
+			existingIndexes, err := listIndexKeys(ctx, collection)
+			if err != nil {
+				return fmt.Errorf("获取集合 '%s' 的现有索引失败: %w", collectionCfg.Name, err)
+			}
 
+			var indexModels []mongo.IndexModel
+			for _, indexCfg := range indexDefs {
 				opts := options.Index()
+				indexName := ""
 				for optKey, optVal := range indexCfg.Options {
 					switch optKey {
 					case "unique":
@@ -149,20 +131,28 @@ func initMongoDBSchema(ctx context.Context, cfg *config.MongoDBClusterSchemaConf
 					case "name":
 						if val, ok := optVal.(string); ok {
 							opts.SetName(val)
+							indexName = val
 						}
 					case "sparse":
 						if val, ok := optVal.(bool); ok {
 							opts.SetSparse(val)
 						}
 					case "expireAfterSeconds":
-						if val, ok := optVal.(float64); ok {
-							opts.SetExpireAfterSeconds(int32(val))
-						}
+						opts.SetExpireAfterSeconds(int32(utils.ToInt(optVal)))
 					default:
 						global.CHAT_LOG.Warn(fmt.Sprintf("未识别的 MongoDB 索引选项 '%s' for collection '%s'", optKey, collectionCfg.Name))
 					}
 				}
-				indexModels = append(indexModels, mongo.IndexModel{Keys: keysDoc, Options: opts})
+
+				// 同名索引的字段定义已变更时，先删除旧索引再重建
+				if oldKeys, exists := existingIndexes[indexName]; exists && indexName != "_id_" && !indexKeysEqual(oldKeys, indexCfg.Keys) {
+					global.CHAT_LOG.Warn(fmt.Sprintf("集合 '%s' 的索引 '%s' 字段定义已变更，删除旧索引后重建", collectionCfg.Name, indexName),
+						"old_keys", oldKeys, "new_keys", indexCfg.Keys)
+					if err := collection.Indexes().DropOne(ctx, indexName); err != nil {
+						return fmt.Errorf("删除集合 '%s' 的旧索引 '%s' 失败: %w", collectionCfg.Name, indexName, err)
+					}
+				}
+				indexModels = append(indexModels, mongo.IndexModel{Keys: indexCfg.Keys, Options: opts})
 			}
 			if len(indexModels) > 0 {
 				_, err := collection.Indexes().CreateMany(ctx, indexModels)
@@ -173,18 +163,9 @@ func initMongoDBSchema(ctx context.Context, cfg *config.MongoDBClusterSchemaConf
 			}
 		}
 
-		// --- 2. 处理 Schema Validation 命令文件 ---
+		// --- 3. 应用 Schema Validation 命令 ---
 		if collectionCfg.ValidatorCommandFile != "" {
 			global.CHAT_LOG.Info(fmt.Sprintf("应用集合 '%s' 的 Schema Validation 规则...", collectionCfg.Name))
-			commandBytes, err := os.ReadFile(collectionCfg.ValidatorCommandFile)
-			if err != nil {
-				return fmt.Errorf("读取 MongoDB Schema Validation 文件 '%s' 失败: %w", collectionCfg.ValidatorCommandFile, err)
-			}
-
-			var commandDoc bson.D
-			if err := bson.UnmarshalExtJSON(commandBytes, true, &commandDoc); err != nil {
-				return fmt.Errorf("解析 MongoDB Schema Validation 命令文件 '%s' (JSON) 失败: %w", collectionCfg.ValidatorCommandFile, err)
-			}
 
 			// 动态更新 collMod 字段以匹配集合名称
 			foundCollMod := false
@@ -200,12 +181,12 @@ func initMongoDBSchema(ctx context.Context, cfg *config.MongoDBClusterSchemaConf
 			}
 
 			var result bson.M
-			err = db.RunCommand(ctx, commandDoc).Decode(&result)
+			err := db.RunCommand(ctx, commandDoc).Decode(&result)
 			if err != nil {
 				return fmt.Errorf("执行 MongoDB collMod 命令失败: %w", err)
 			}
 
-			if ok, found := result["ok"]; !found || ok.(float64) != 1.0 {
+			if ok, found := result["ok"]; !found || utils.ToFloat64(ok) != 1.0 {
 				return fmt.Errorf("执行 MongoDB collMod 命令返回错误: %v", result)
 			}
 			global.CHAT_LOG.Info(fmt.Sprintf("集合 '%s' 的 Schema Validation 规则应用成功。", collectionCfg.Name))
@@ -214,6 +195,103 @@ func initMongoDBSchema(ctx context.Context, cfg *config.MongoDBClusterSchemaConf
 	return nil
 }
 
+// lookupJSONSchema 从 collMod 命令中取出 validator.$jsonSchema
+func lookupJSONSchema(commandDoc bson.D) (bson.Raw, error) {
+	commandBytes, err := bson.Marshal(commandDoc)
+	if err != nil {
+		return nil, err
+	}
+	val, err := bson.Raw(commandBytes).LookupErr("validator", "$jsonSchema")
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := val.DocumentOK()
+	if !ok {
+		return nil, errors.New("$jsonSchema 不是对象")
+	}
+	return schema, nil
+}
+
+// validateIndexFields 校验索引的所有字段都在 $jsonSchema 的 properties 中声明，支持以.分隔的嵌套字段
+func validateIndexFields(indexDefs []config.MongoDBIndexSchema, jsonSchema bson.Raw) error {
+	var unknown []string
+	for _, indexCfg := range indexDefs {
+		for _, key := range indexCfg.Keys {
+			if key.Key == "_id" || schemaHasField(jsonSchema, key.Key) {
+				continue
+			}
+			unknown = append(unknown, fmt.Sprintf("%v.%s", indexCfg.Options["name"], key.Key))
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("索引字段未在 $jsonSchema 中声明: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// schemaHasField 判断 $jsonSchema 中是否声明了字段，会同时查找 oneOf/anyOf/allOf 的各个分支
+func schemaHasField(schema bson.Raw, field string) bool {
+	part, rest, nested := strings.Cut(field, ".")
+	if val, err := schema.LookupErr("properties", part); err == nil {
+		if doc, ok := val.DocumentOK(); ok && (!nested || schemaHasField(doc, rest)) {
+			return true
+		}
+	}
+	for _, keyword := range []string{"oneOf", "anyOf", "allOf"} {
+		val, err := schema.LookupErr(keyword)
+		if err != nil {
+			continue
+		}
+		branches, ok := val.ArrayOK()
+		if !ok {
+			continue
+		}
+		values, _ := branches.Values()
+		for _, branch := range values {
+			if doc, ok := branch.DocumentOK(); ok && schemaHasField(doc, field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listIndexKeys 获取集合现有索引，返回索引名到索引字段的映射
+func listIndexKeys(ctx context.Context, collection *mongo.Collection) (map[string]bson.D, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []struct {
+		Name string `bson:"name"`
+		Key  bson.D `bson:"key"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+	result := make(map[string]bson.D, len(indexes))
+	for _, index := range indexes {
+		result[index.Name] = index.Key
+	}
+	return result, nil
+}
+
+// indexKeysEqual 比较两个索引的字段和顺序是否一致，数值类型不同但值相同视为一致
+func indexKeysEqual(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+		if utils.ToFloat64(a[i].Value) != utils.ToFloat64(b[i].Value) && fmt.Sprint(a[i].Value) != fmt.Sprint(b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
 // initElasticsearchSchema handles Elasticsearch index creation from a request file.
 // 接收一个 *config.ElasticsearchClusterSchemaConfig 实例作为参数
 func initElasticsearchSchema(ctx context.Context, cfg *config.ElasticsearchClusterSchemaConfig) error { // <-- 修改函数签名
@@ -221,41 +299,11 @@ func initElasticsearchSchema(ctx context.Context, cfg *config.ElasticsearchClust
 		return errors.New("Elasticsearch 客户端未初始化")
 	}
 
+	// 索引名作为别名，实际索引带版本号；映射变更时按 auto_migrate 配置重建并切换别名
 	for _, indexCfg := range cfg.Indices { // <-- 使用传入的 cfg
 		global.CHAT_LOG.Info(fmt.Sprintf("检查 Elasticsearch 索引 '%s'...", indexCfg.Name))
-
-		existsRes, err := global.CHAT_ES.Indices.Exists([]string{indexCfg.Name}, global.CHAT_ES.Indices.Exists.WithContext(ctx))
-		if err != nil {
-			return fmt.Errorf("检查 ES 索引 '%s' 是否存在失败: %w", indexCfg.Name, err)
-		}
-		defer existsRes.Body.Close()
-
-		if existsRes.IsError() {
-			if existsRes.StatusCode == 404 {
-				global.CHAT_LOG.Info(fmt.Sprintf("ES 索引 '%s' 不存在，开始创建...", indexCfg.Name))
-
-				requestBytes, err := os.ReadFile(indexCfg.RequestFile)
-				if err != nil {
-					return fmt.Errorf("读取 ES 索引 '%s' 请求体文件 '%s' 失败: %w", indexCfg.Name, indexCfg.RequestFile, err)
-				}
-
-				createRes, createErr := global.CHAT_ES.Indices.Create(indexCfg.Name,
-					global.CHAT_ES.Indices.Create.WithBody(strings.NewReader(string(requestBytes))),
-					global.CHAT_ES.Indices.Create.WithContext(ctx),
-				)
-				if createErr != nil {
-					return fmt.Errorf("创建 ES 索引 '%s' 失败: %w", indexCfg.Name, createErr)
-				}
-				defer createRes.Body.Close()
-				if createRes.IsError() {
-					return fmt.Errorf("创建 ES 索引 '%s' 失败 (ES 响应错误): %s", indexCfg.Name, createRes.String())
-				}
-				global.CHAT_LOG.Info(fmt.Sprintf("ES 索引 '%s' 创建成功。", indexCfg.Name))
-			} else {
-				return fmt.Errorf("检查 ES 索引 '%s' 存在性返回非 404 错误: %s", indexCfg.Name, existsRes.String())
-			}
-		} else {
-			global.CHAT_LOG.Info(fmt.Sprintf("ES 索引 '%s' 已存在。", indexCfg.Name))
+		if err := service.ServiceGroupApp.EnsureIndex(ctx, indexCfg); err != nil {
+			return fmt.Errorf("初始化 ES 索引 '%s' 失败: %w", indexCfg.Name, err)
 		}
 	}
 	return nil
@@ -15,6 +15,8 @@ func StartWebSocketManager(ctx context.Context) {
 	global.CHAT_UPGRADER = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		// 客户端通过 Sec-WebSocket-Protocol 选择 JSON 或 MessagePack 编码
+		Subprotocols: service.Subprotocols(),
 		CheckOrigin: func(r *http.Request) bool {
 			return true // 允许所有跨域请求，生产环境应该限制
 		},
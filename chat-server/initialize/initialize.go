@@ -14,29 +14,9 @@ import (
 // Initialize 函数负责所有应用程序的初始化
 // 它接受一个 context 和 WaitGroup，用于统一管理 Goroutine 生命周期
 func Initialize(appCtx context.Context, appCancel context.CancelFunc, wg *sync.WaitGroup) error { // 接受 appCtx 和 wg
-
-	// 初始化配置文件 (检查错误)
-	if err := InitConfig(); err != nil {
-		return fmt.Errorf("初始化配置文件失败: %w", err)
-	}
-
-	// 初始化日志 (检查错误)
-	if err := InitLogger(); err != nil {
-		return fmt.Errorf("初始化日志工具失败: %w", err)
-	}
-
-	// 初始化数据库 (检查错误)
-	if err := InitMySQL(); err != nil {
-		return fmt.Errorf("初始化 MySQL 失败: %w", err)
-	}
-	if err := InitRedis(); err != nil {
-		return fmt.Errorf("初始化 Redis 失败: %w", err)
-	}
-	if err := InitMongo(); err != nil {
-		return fmt.Errorf("初始化 MongoDB 失败: %w", err)
-	}
-	if err := InitElasticSearch(); err != nil {
-		return fmt.Errorf("初始化 Elasticsearch 失败: %w", err)
+	// 初始化配置、日志和数据库连接
+	if err := InitResources(); err != nil {
+		return err
 	}
 
 	// 数据库结构检测与创建 (传递 AppConfig.DBSchema)
@@ -82,3 +62,31 @@ func Initialize(appCtx context.Context, appCancel context.CancelFunc, wg *sync.W
 	slog.Info("所有应用程序组件初始化完成。")
 	return nil
 }
+
+// InitResources 初始化配置、日志和各个数据库连接，命令行子命令也只需要这些资源
+func InitResources() error {
+	// 初始化配置文件 (检查错误)
+	if err := InitConfig(); err != nil {
+		return fmt.Errorf("初始化配置文件失败: %w", err)
+	}
+
+	// 初始化日志 (检查错误)
+	if err := InitLogger(); err != nil {
+		return fmt.Errorf("初始化日志工具失败: %w", err)
+	}
+
+	// 初始化数据库 (检查错误)
+	if err := InitMySQL(); err != nil {
+		return fmt.Errorf("初始化 MySQL 失败: %w", err)
+	}
+	if err := InitRedis(); err != nil {
+		return fmt.Errorf("初始化 Redis 失败: %w", err)
+	}
+	if err := InitMongo(); err != nil {
+		return fmt.Errorf("初始化 MongoDB 失败: %w", err)
+	}
+	if err := InitElasticSearch(); err != nil {
+		return fmt.Errorf("初始化 Elasticsearch 失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package initialize
+
+import (
+	"chat-server/global"
+	"chat-server/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// 多个节点同时启动时通过 MySQL 命名锁依次执行迁移
+const (
+	migrationLockName    = "schema_migrations"
+	migrationLockTimeout = 60 // 等待迁移锁的秒数
+)
+
+// migrationFilePattern 迁移文件名格式：版本号_名称.up.sql / 版本号_名称.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// schemaMigration 已执行的迁移记录
+type schemaMigration struct {
+	Version   int64  `gorm:"column:version;primaryKey"`
+	Name      string `gorm:"column:name"`
+	AppliedAt int64  `gorm:"column:applied_at"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// mysqlMigration 迁移目录中的一个版本
+type mysqlMigration struct {
+	Version  int64
+	Name     string
+	UpFile   string
+	DownFile string
+}
+
+// MigrationStatus 迁移状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+// MigrateMySQL 按版本顺序执行未执行的 up 迁移，steps<=0 时执行全部
+func MigrateMySQL(ctx context.Context, dir string, steps int) error {
+	return withMigrationLock(ctx, func(db *gorm.DB) error {
+		migrations, applied, err := loadMySQLMigrations(db, dir)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if steps > 0 && count >= steps {
+				break
+			}
+			if migration.UpFile == "" {
+				return fmt.Errorf("迁移 %d_%s 缺少 up 文件", migration.Version, migration.Name)
+			}
+			global.CHAT_LOG.Info(fmt.Sprintf("执行 MySQL 迁移 %d_%s", migration.Version, migration.Name))
+			if err := execMigrationFile(db, migration.UpFile); err != nil {
+				return fmt.Errorf("执行 MySQL 迁移 %d_%s 失败: %w", migration.Version, migration.Name, err)
+			}
+			record := schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: utils.GetUTCMillisTimestamp()}
+			if err := db.Create(&record).Error; err != nil {
+				return fmt.Errorf("记录 MySQL 迁移 %d_%s 失败: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		global.CHAT_LOG.Info(fmt.Sprintf("MySQL 迁移完成，本次执行 %d 个", count))
+		return nil
+	})
+}
+
+// RollbackMySQL 按版本倒序回滚已执行的迁移，steps<=0 时回滚一个
+func RollbackMySQL(ctx context.Context, dir string, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+	return withMigrationLock(ctx, func(db *gorm.DB) error {
+		migrations, applied, err := loadMySQLMigrations(db, dir)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.DownFile == "" {
+				return fmt.Errorf("迁移 %d_%s 缺少 down 文件，无法回滚", migration.Version, migration.Name)
+			}
+			global.CHAT_LOG.Info(fmt.Sprintf("回滚 MySQL 迁移 %d_%s", migration.Version, migration.Name))
+			if err := execMigrationFile(db, migration.DownFile); err != nil {
+				return fmt.Errorf("回滚 MySQL 迁移 %d_%s 失败: %w", migration.Version, migration.Name, err)
+			}
+			if err := db.Delete(&schemaMigration{}, migration.Version).Error; err != nil {
+				return fmt.Errorf("删除 MySQL 迁移记录 %d_%s 失败: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		global.CHAT_LOG.Info(fmt.Sprintf("MySQL 回滚完成，本次回滚 %d 个", count))
+		return nil
+	})
+}
+
+// MySQLMigrationStatus 列出迁移目录中每个版本的执行状态
+func MySQLMigrationStatus(ctx context.Context, dir string) ([]MigrationStatus, error) {
+	if global.CHAT_MYSQL == nil {
+		return nil, errors.New("MySQL 客户端未初始化")
+	}
+	migrations, applied, err := loadMySQLMigrations(global.CHAT_MYSQL.WithContext(ctx), dir)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: ok, AppliedAt: record.AppliedAt})
+	}
+	return statuses, nil
+}
+
+// withMigrationLock 在同一个连接上持有迁移锁执行 fn，多个节点同时启动时依次迁移，后执行的节点不会重复执行已完成的迁移
+// 迁移文件中的会话变量和预处理语句也依赖于在同一个连接上执行
+func withMigrationLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	if global.CHAT_MYSQL == nil {
+		return errors.New("MySQL 客户端未初始化")
+	}
+	return global.CHAT_MYSQL.WithContext(ctx).Connection(func(db *gorm.DB) error {
+		var locked sql.NullInt64
+		if err := db.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Row().Scan(&locked); err != nil {
+			return fmt.Errorf("获取 MySQL 迁移锁失败: %w", err)
+		}
+		if !locked.Valid || locked.Int64 != 1 {
+			return fmt.Errorf("获取 MySQL 迁移锁超时，其他节点正在执行迁移")
+		}
+		defer func() {
+			if err := db.Exec("SELECT RELEASE_LOCK(?)", migrationLockName).Error; err != nil {
+				global.CHAT_LOG.Error("释放 MySQL 迁移锁失败", "err", err)
+			}
+		}()
+		return fn(db)
+	})
+}
+
+// loadMySQLMigrations 读取迁移目录和已执行的迁移记录
+func loadMySQLMigrations(db *gorm.DB, dir string) ([]mysqlMigration, map[int64]schemaMigration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取 MySQL 迁移目录 '%s' 失败: %w", dir, err)
+	}
+
+	byVersion := make(map[int64]*mysqlMigration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &mysqlMigration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, nil, fmt.Errorf("MySQL 迁移版本 %d 存在不同名称的文件: %s, %s", version, migration.Name, match[2])
+		}
+		path := filepath.Join(dir, entry.Name())
+		if match[3] == "up" {
+			migration.UpFile = path
+		} else {
+			migration.DownFile = path
+		}
+	}
+	migrations := make([]mysqlMigration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	if err := db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+		"`version` BIGINT NOT NULL COMMENT '迁移版本号'," +
+		"`name` VARCHAR(255) NOT NULL COMMENT '迁移名称'," +
+		"`applied_at` BIGINT NOT NULL COMMENT '执行时间戳 (毫秒)'," +
+		"PRIMARY KEY (`version`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci").Error; err != nil {
+		return nil, nil, fmt.Errorf("创建 schema_migrations 表失败: %w", err)
+	}
+	var records []schemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, nil, fmt.Errorf("查询 schema_migrations 失败: %w", err)
+	}
+	applied := make(map[int64]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return migrations, applied, nil
+}
+
+// execMigrationFile 逐条执行迁移文件中的语句
+// MySQL 的 DDL 会隐式提交，无法整体回滚，执行失败时需要根据日志手动修复后重试
+func execMigrationFile(db *gorm.DB, path string) error {
+	sqlBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取迁移文件 '%s' 失败: %w", path, err)
+	}
+	for _, statement := range utils.SplitSQLStatements(string(sqlBytes)) {
+		if err := db.Exec(statement).Error; err != nil {
+			global.CHAT_LOG.Error(fmt.Sprintf("执行 MySQL SQL语句失败: %v\nSQL: %s", err, statement))
+			return err
+		}
+	}
+	return nil
+}
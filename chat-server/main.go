@@ -31,6 +31,21 @@ func main() {
 	defer appCancel()
 	var wg sync.WaitGroup
 
+	// 带参数启动时执行子命令，执行完直接退出
+	if len(os.Args) > 1 {
+		if err := initialize.InitResources(); err != nil {
+			slog.Error("应用程序初始化失败:", "err", err)
+			os.Exit(1)
+		}
+		err := core.RunCommand(appCtx, os.Args[1:])
+		core.CloseResource()
+		if err != nil {
+			slog.Error("子命令执行失败:", "command", os.Args[1], "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	err := initialize.Initialize(appCtx, appCancel, &wg)
 	if err != nil {
 		slog.Error("应用程序初始化失败:", "err", err)
@@ -20,4 +20,23 @@ var (
 	USER_ID_NOT_FOUND      = ResponseCode{Code: 407, Msg: "用户id不存在"}
 	USER_ACCOUNT_NOT_FOUND = ResponseCode{Code: 408, Msg: "用户账号不存在"}
 	USER_NOT_FOUND         = ResponseCode{Code: 409, Msg: "用户不存在"}
+	ROOM_NOT_FOUND         = ResponseCode{Code: 410, Msg: "房间不存在"}
+	ROOM_NOT_MEMBER        = ResponseCode{Code: 411, Msg: "不是房间成员"}
+	ROOM_PERMISSION_DENIED = ResponseCode{Code: 412, Msg: "没有该房间的操作权限"}
+	ROOM_ALREADY_MEMBER    = ResponseCode{Code: 413, Msg: "已经是房间成员"}
+	ROOM_INVITE_INVALID    = ResponseCode{Code: 414, Msg: "邀请链接无效或已过期"}
+	JOIN_REQUEST_EXISTS    = ResponseCode{Code: 415, Msg: "已提交加入申请，请等待审核"}
+	JOIN_REQUEST_NOT_FOUND = ResponseCode{Code: 416, Msg: "加入申请不存在或已处理"}
+	ROOM_CREATOR_LEAVE     = ResponseCode{Code: 417, Msg: "房主不能退出房间"}
+	MESSAGE_NOT_FOUND      = ResponseCode{Code: 418, Msg: "消息不存在或已删除"}
+	MESSAGE_NOT_EDITABLE   = ResponseCode{Code: 419, Msg: "该类型的消息不能编辑"}
+	MESSAGE_EDIT_EXPIRED   = ResponseCode{Code: 420, Msg: "已超过可编辑或删除的时间"}
+	REACTION_LIMIT         = ResponseCode{Code: 421, Msg: "该消息的表情回应种类已达上限"}
+	REPLY_PARENT_INVALID   = ResponseCode{Code: 422, Msg: "回复的消息不存在或不在当前房间"}
+	SUBSCRIPTION_LIMIT     = ResponseCode{Code: 423, Msg: "订阅的房间数量已达上限"}
+	WS_INVALID_FRAME       = ResponseCode{Code: 424, Msg: "消息格式无效"}
+	WS_UNSUPPORTED_VERSION = ResponseCode{Code: 425, Msg: "不支持的协议版本"}
+	WS_UNKNOWN_TYPE        = ResponseCode{Code: 426, Msg: "未知的消息类型"}
+	WS_NOT_SUBSCRIBED      = ResponseCode{Code: 427, Msg: "没有订阅消息的目标房间"}
+	MESSAGE_INVALID        = ResponseCode{Code: 428, Msg: "消息内容无效"}
 )
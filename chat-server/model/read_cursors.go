@@ -0,0 +1,14 @@
+package model
+
+import "go.mongodb.org/mongo-driver/v2/bson"
+
+// ReadCursors 用户在房间内的已读位置，每个用户每个房间一条
+// read_at 为最后已读消息的创建时间，和 message_id 一起作为比较游标
+type ReadCursors struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserId    string        `bson:"user_id" json:"user_id"`
+	RoomId    string        `bson:"room_id" json:"room_id"`
+	MessageId bson.ObjectID `bson:"message_id" json:"message_id"`
+	ReadAt    int64         `bson:"read_at" json:"read_at"`
+	UpdatedAt int64         `bson:"updated_at" json:"updated_at"`
+}
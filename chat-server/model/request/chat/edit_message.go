@@ -0,0 +1,6 @@
+package chat
+
+// 编辑消息请求结构
+type EditMessageRequest struct {
+	Text string `json:"text" binding:"required,max=5000"`
+}
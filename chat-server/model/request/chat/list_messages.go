@@ -0,0 +1,10 @@
+package chat
+
+// 历史消息分页查询请求结构
+// before/after 为游标，可以是消息id(ObjectID)或毫秒时间戳，二者最多传一个
+// limit 为每页数量，默认50，最大100
+type ListMessagesRequest struct {
+	Before string `form:"before"`
+	After  string `form:"after"`
+	Limit  int64  `form:"limit,default=50" binding:"min=1,max=100"`
+}
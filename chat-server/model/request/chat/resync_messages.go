@@ -0,0 +1,7 @@
+package chat
+
+// 按序号补发消息请求结构，to_seq 不传时补发到最新
+type ResyncMessagesRequest struct {
+	FromSeq int64 `form:"from_seq" binding:"required,min=1"`
+	ToSeq   int64 `form:"to_seq" binding:"omitempty,min=1"`
+}
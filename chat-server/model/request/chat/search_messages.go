@@ -0,0 +1,14 @@
+package chat
+
+// 消息全文搜索请求结构
+// start_time/end_time 为毫秒时间戳，page 从1开始，page*page_size 不能超过 10000
+type SearchMessagesRequest struct {
+	Keyword   string `form:"q" binding:"required,max=100"`
+	RoomId    string `form:"room_id"`
+	SenderId  string `form:"sender_id"`
+	Type      string `form:"type" binding:"omitempty,oneof=text image file voice video reply"`
+	StartTime int64  `form:"start_time" binding:"omitempty,min=0"`
+	EndTime   int64  `form:"end_time" binding:"omitempty,min=0"`
+	Page      int    `form:"page" binding:"omitempty,min=1,max=10000"`
+	PageSize  int    `form:"page_size" binding:"omitempty,min=1,max=50"`
+}
@@ -0,0 +1,6 @@
+package presence
+
+// 查询用户在线状态请求结构，user_ids 为逗号分隔的用户id，最多100个
+type QueryPresenceRequest struct {
+	UserIds string `form:"user_ids" binding:"required"`
+}
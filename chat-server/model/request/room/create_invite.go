@@ -0,0 +1,7 @@
+package room
+
+// 创建邀请链接请求结构，字段为0表示不限制
+type CreateInviteRequest struct {
+	ExpiresIn int64 `json:"expires_in" binding:"min=0"` // 有效时长(秒)
+	MaxUses   int   `json:"max_uses" binding:"min=0"`   // 最大使用次数
+}
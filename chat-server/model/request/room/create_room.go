@@ -0,0 +1,7 @@
+package room
+
+// 创建房间请求结构
+type CreateRoomRequest struct {
+	RoomName  string `json:"room_name" binding:"required,max=255"`
+	IsPrivate bool   `json:"is_private"`
+}
@@ -0,0 +1,6 @@
+package room
+
+// 审核加入申请请求结构
+type HandleJoinRequest struct {
+	Approve *bool `json:"approve" binding:"required"`
+}
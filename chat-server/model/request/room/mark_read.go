@@ -0,0 +1,6 @@
+package room
+
+// 标记已读请求结构
+type MarkReadRequest struct {
+	MessageId string `json:"message_id" binding:"required,len=24,hexadecimal"`
+}
@@ -0,0 +1,6 @@
+package room
+
+// 修改成员角色请求结构
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member readonly"`
+}
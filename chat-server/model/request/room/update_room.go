@@ -0,0 +1,8 @@
+package room
+
+// 修改房间信息请求结构，字段为空则不修改
+type UpdateRoomRequest struct {
+	RoomName       *string `json:"room_name" binding:"omitempty,min=1,max=255"`
+	IsPrivate      *bool   `json:"is_private"`
+	IsAnnouncement *bool   `json:"is_announcement"`
+}
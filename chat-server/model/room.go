@@ -1,13 +1,15 @@
 package model
 
 type Room struct {
-	ID        string `gorm:"primaryKey;type:varchar(255)"`
-	RoomName  string `gorm:"type:varchar(255);not null"`
-	CreatorID string `gorm:"type:varchar(255);not null"`
-	IsPrivate bool   `gorm:"type:tinyint(1);not null"` // 使用 bool 映射 tinyint(1)
-	IsDelete  bool   `gorm:"type:tinyint(1);not null"`
-	CreatedAt int64  `gorm:"not null"`
-	UpdatedAt int64  `gorm:"not null"`
+	ID             string `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	RoomName       string `gorm:"type:varchar(255);not null" json:"room_name"`
+	CreatorID      string `gorm:"type:varchar(255);not null" json:"creator_id"`
+	IsPrivate      bool   `gorm:"type:tinyint(1);not null" json:"is_private"`      // 使用 bool 映射 tinyint(1)
+	IsAnnouncement bool   `gorm:"type:tinyint(1);not null" json:"is_announcement"` // 公告房间只有房主和管理员可以发言
+	IsDirect       bool   `gorm:"type:tinyint(1);not null" json:"is_direct"`       // 一对一私聊房间
+	IsDelete       bool   `gorm:"type:tinyint(1);not null" json:"-"`
+	CreatedAt      int64  `gorm:"not null" json:"created_at"`
+	UpdatedAt      int64  `gorm:"not null" json:"updated_at"`
 	// Foreign key, GORM will handle this if you have the User model
-	Creator User `gorm:"foreignKey:CreatorID"`
+	Creator User `gorm:"foreignKey:CreatorID" json:"-"`
 }
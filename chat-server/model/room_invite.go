@@ -0,0 +1,13 @@
+package model
+
+type RoomInvite struct {
+	ID        string `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	RoomID    string `gorm:"type:varchar(255);not null" json:"room_id"`
+	CreatorID string `gorm:"type:varchar(255);not null" json:"creator_id"`
+	Code      string `gorm:"unique;type:varchar(64);not null" json:"code"`
+	MaxUses   int    `gorm:"not null" json:"max_uses"`   // 0为不限制
+	UsedCount int    `gorm:"not null" json:"used_count"` // 已使用次数
+	ExpiresAt int64  `gorm:"not null" json:"expires_at"` // 0为永不过期
+	IsRevoked bool   `gorm:"type:tinyint(1);not null" json:"is_revoked"`
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package model
+
+type RoomJoinRequest struct {
+	ID        string `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	RoomID    string `gorm:"type:varchar(255);not null" json:"room_id"`
+	UserID    string `gorm:"type:varchar(255);not null" json:"user_id"`
+	Status    string `gorm:"type:varchar(32);not null" json:"status"`
+	HandledBy string `gorm:"type:varchar(255);not null" json:"handled_by"`
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+	HandledAt int64  `gorm:"not null" json:"handled_at"`
+}
@@ -1,12 +1,13 @@
 package model
 
 type RoomMembers struct {
-	ID       string `gorm:"primaryKey;type:varchar(255)"`
-	UserID   string `gorm:"type:varchar(255);not null"`
-	RoomID   string `gorm:"type:varchar(255);not null"`
-	JoinedAt int64  `gorm:"not null"`
-	User     User   `gorm:"foreignKey:UserID"`
-	Room     Room   `gorm:"foreignKey:RoomID"`
+	ID       string `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	UserID   string `gorm:"type:varchar(255);not null" json:"user_id"`
+	RoomID   string `gorm:"type:varchar(255);not null" json:"room_id"`
+	Role     string `gorm:"type:varchar(32);not null" json:"role"` // owner、admin、member、readonly
+	JoinedAt int64  `gorm:"not null" json:"joined_at"`
+	User     User   `gorm:"foreignKey:UserID" json:"-"`
+	Room     Room   `gorm:"foreignKey:RoomID" json:"-"`
 }
 
 func (m RoomMembers) TableName() string {
@@ -10,6 +10,8 @@ type SystemMessages struct {
 	Type      string               `bson:"type" json:"type"`             // 同时支持BSON和JSON
 	Content   SystemMessageContent `bson:"content" json:"content"`       // 同时支持BSON和JSON
 	CreatedAt int64                `bson:"created_at" json:"created_at"` // 同时支持BSON和JSON
+	// 房间内递增的序号，客户端用来发现缺失的消息
+	Seq int64 `bson:"seq,omitempty" json:"seq,omitempty"`
 }
 
 // 内容模型
@@ -10,6 +10,31 @@ type UserMessages struct {
 	Type      string             `bson:"type" json:"type"`             // 同时支持BSON和JSON
 	Content   UserMessageContent `bson:"content" json:"content"`       // 同时支持BSON和JSON
 	CreatedAt int64              `bson:"created_at" json:"created_at"` // 同时支持BSON和JSON
+	// 房间内递增的序号，客户端用来发现缺失的消息
+	Seq int64 `bson:"seq,omitempty" json:"seq,omitempty"`
+	// 编辑和删除，删除后 content 和编辑历史被清空，只保留墓碑
+	EditHistory []UserMessageEdit `bson:"edit_history,omitempty" json:"edit_history,omitempty"`
+	EditedAt    int64             `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	IsDeleted   bool              `bson:"is_deleted,omitempty" json:"is_deleted,omitempty"`
+	DeletedAt   int64             `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	// 表情回应，每个表情一条记录
+	Reactions []UserMessageReaction `bson:"reactions,omitempty" json:"reactions,omitempty"`
+	// 线程，只记录在线程的根消息上，回复通过 content.reply.reply_to 指向根消息
+	ReplyCount      int      `bson:"reply_count,omitempty" json:"reply_count,omitempty"`
+	LastReplyAt     int64    `bson:"last_reply_at,omitempty" json:"last_reply_at,omitempty"`
+	ThreadFollowers []string `bson:"thread_followers,omitempty" json:"-"`
+}
+
+// UserMessageReaction 表情回应，user_ids 为回应了该表情的用户集合
+type UserMessageReaction struct {
+	Emoji   string   `bson:"emoji" json:"emoji"`
+	UserIds []string `bson:"user_ids" json:"user_ids"`
+}
+
+// UserMessageEdit 编辑历史，记录每次编辑前的内容
+type UserMessageEdit struct {
+	Content  UserMessageContent `bson:"content" json:"content"`
+	EditedAt int64              `bson:"edited_at" json:"edited_at"`
 }
 
 // 内容模型
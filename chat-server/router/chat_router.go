@@ -13,5 +13,13 @@ func (s *ChatRouter) InitChatRouter(apiV1 *gin.RouterGroup) {
 	chatGroup := apiV1.Group("/chat")
 	{
 		chatGroup.GET("/webSocketHandler", v1.ApiGroupApp.WebSocketHandler)
+		chatGroup.POST("/direct", v1.ApiGroupApp.SendDirectMessage)
+		chatGroup.PUT("/message/:id", v1.ApiGroupApp.EditMessage)
+		chatGroup.DELETE("/message/:id", v1.ApiGroupApp.DeleteMessage)
+		chatGroup.PUT("/message/:id/reactions/:emoji", v1.ApiGroupApp.AddReaction)
+		chatGroup.DELETE("/message/:id/reactions/:emoji", v1.ApiGroupApp.RemoveReaction)
+		chatGroup.GET("/message/:id/thread", v1.ApiGroupApp.ListThreadMessages)
+		chatGroup.PUT("/message/:id/follow", v1.ApiGroupApp.FollowThread)
+		chatGroup.DELETE("/message/:id/follow", v1.ApiGroupApp.UnfollowThread)
 	}
 }
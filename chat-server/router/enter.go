@@ -10,10 +10,15 @@ type RouterGroup struct {
 	UserRouter
 	ChatRouter
 	TokenRouter
+	RoomRouter
+	SearchRouter
+	PresenceRouter
 }
 
 var (
-	userApi  = v1.ApiGroupApp.UserApi
-	chatApi  = v1.ApiGroupApp.ChatApi
-	tokenApi = v1.ApiGroupApp.TokenApi
+	userApi   = v1.ApiGroupApp.UserApi
+	chatApi   = v1.ApiGroupApp.ChatApi
+	tokenApi  = v1.ApiGroupApp.TokenApi
+	roomApi   = v1.ApiGroupApp.RoomApi
+	searchApi = v1.ApiGroupApp.SearchApi
 )
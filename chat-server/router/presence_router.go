@@ -0,0 +1,18 @@
+package router
+
+import (
+	"chat-server/api/v1"
+	"github.com/gin-gonic/gin"
+)
+
+type PresenceRouter struct{}
+
+// InitPresenceRouter 初始化在线状态相关路由
+func (s *PresenceRouter) InitPresenceRouter(apiV1 *gin.RouterGroup) {
+	// 在线状态相关路由 - 需要认证
+	presenceGroup := apiV1.Group("/presence")
+	{
+		presenceGroup.GET("/room/:id", v1.ApiGroupApp.ListRoomOnline)
+		presenceGroup.GET("/users", v1.ApiGroupApp.GetUsersPresence)
+	}
+}
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"chat-server/api/v1"
+	"github.com/gin-gonic/gin"
+)
+
+type RoomRouter struct{}
+
+// InitRoomRouter 初始化房间相关路由
+func (s *RoomRouter) InitRoomRouter(apiV1 *gin.RouterGroup) {
+	// 房间相关路由 - 需要认证
+	roomGroup := apiV1.Group("/room")
+	{
+		roomGroup.POST("", v1.ApiGroupApp.CreateRoom)
+		roomGroup.GET("/mine", v1.ApiGroupApp.ListMyRooms)
+		roomGroup.GET("/unread", v1.ApiGroupApp.ListUnreadCounts)
+		roomGroup.GET("/:id", v1.ApiGroupApp.GetRoom)
+		roomGroup.PUT("/:id", v1.ApiGroupApp.UpdateRoom)
+		roomGroup.DELETE("/:id", v1.ApiGroupApp.DeleteRoom)
+		roomGroup.GET("/:id/messages", v1.ApiGroupApp.ListMessages)
+		roomGroup.POST("/:id/read", v1.ApiGroupApp.MarkRead)
+		roomGroup.GET("/:id/resync", v1.ApiGroupApp.ResyncMessages)
+
+		// 成员管理
+		roomGroup.GET("/:id/members", v1.ApiGroupApp.ListMembers)
+		roomGroup.DELETE("/:id/members/:user_id", v1.ApiGroupApp.KickMember)
+		roomGroup.PUT("/:id/members/:user_id/role", v1.ApiGroupApp.UpdateMemberRole)
+		roomGroup.POST("/:id/join", v1.ApiGroupApp.JoinRoom)
+		roomGroup.POST("/:id/leave", v1.ApiGroupApp.LeaveRoom)
+
+		// 邀请链接与加入申请
+		roomGroup.POST("/:id/invites", v1.ApiGroupApp.CreateInvite)
+		roomGroup.DELETE("/:id/invites/:invite_id", v1.ApiGroupApp.RevokeInvite)
+		roomGroup.POST("/invite/:code/join", v1.ApiGroupApp.JoinByInvite)
+		roomGroup.GET("/:id/joinRequests", v1.ApiGroupApp.ListJoinRequests)
+		roomGroup.PUT("/:id/joinRequests/:request_id", v1.ApiGroupApp.HandleJoinRequest)
+	}
+}
@@ -0,0 +1,17 @@
+package router
+
+import (
+	"chat-server/api/v1"
+	"github.com/gin-gonic/gin"
+)
+
+type SearchRouter struct{}
+
+// InitSearchRouter 初始化搜索相关路由
+func (s *SearchRouter) InitSearchRouter(apiV1 *gin.RouterGroup) {
+	// 搜索相关路由 - 需要认证
+	searchGroup := apiV1.Group("/search")
+	{
+		searchGroup.GET("/messages", v1.ApiGroupApp.SearchMessages)
+	}
+}
@@ -0,0 +1,4 @@
+-- 按外键依赖的相反顺序删除初始表
+DROP TABLE IF EXISTS `room_members`;
+DROP TABLE IF EXISTS `room`;
+DROP TABLE IF EXISTS `user`;
@@ -1,7 +1,4 @@
--- 数据库名称：chat (这里是创建一个名为 chat 的数据库，如果你希望使用现有数据库，可以移除这行，并在 Go 配置中指定数据库名)
-CREATE DATABASE IF NOT EXISTS `chat`;
-USE `chat`;
-
+-- 初始表结构：用户、房间、房间成员
 CREATE TABLE IF NOT EXISTS `user` (
     `id` VARCHAR(255) NOT NULL COMMENT '用户ID',
     `user_account` VARCHAR(255) NOT NULL UNIQUE, -- user_account 通常是唯一的
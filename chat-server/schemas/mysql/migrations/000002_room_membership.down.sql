@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS `room_join_request`;
+DROP TABLE IF EXISTS `room_invite`;
+
+ALTER TABLE `room_members` DROP COLUMN `role`;
+
+ALTER TABLE `room`
+    DROP COLUMN `is_direct`,
+    DROP COLUMN `is_announcement`;
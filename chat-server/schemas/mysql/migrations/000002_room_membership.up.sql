@@ -0,0 +1,59 @@
+-- 房间公告/私聊属性、成员角色、邀请链接和入群申请
+-- 由旧版 chat.sql 建表的数据库可能已有部分列，只添加不存在的列
+SET @ddl = IF((SELECT COUNT(*) FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'room' AND COLUMN_NAME = 'is_announcement') = 0,
+    'ALTER TABLE `room` ADD COLUMN `is_announcement` TINYINT(1) NOT NULL DEFAULT 0 COMMENT ''是否公告房间，公告房间只有房主和管理员可以发言'' AFTER `is_private`',
+    'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = IF((SELECT COUNT(*) FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'room' AND COLUMN_NAME = 'is_direct') = 0,
+    'ALTER TABLE `room` ADD COLUMN `is_direct` TINYINT(1) NOT NULL DEFAULT 0 COMMENT ''是否一对一私聊房间'' AFTER `is_announcement`',
+    'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = IF((SELECT COUNT(*) FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'room_members' AND COLUMN_NAME = 'role') = 0,
+    'ALTER TABLE `room_members` ADD COLUMN `role` VARCHAR(32) NOT NULL DEFAULT ''member'' COMMENT ''成员角色：owner、admin、member、readonly'' AFTER `room_id`',
+    'DO 0');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- 房间创建者的成员记录设为房主
+UPDATE `room_members` rm JOIN `room` r ON rm.`room_id` = r.`id` AND rm.`user_id` = r.`creator_id`
+SET rm.`role` = 'owner';
+
+CREATE TABLE IF NOT EXISTS `room_invite` (
+    `id` VARCHAR(255) NOT NULL COMMENT '邀请ID',
+    `room_id` VARCHAR(255) NOT NULL,
+    `creator_id` VARCHAR(255) NOT NULL,
+    `code` VARCHAR(64) NOT NULL UNIQUE COMMENT '邀请码',
+    `max_uses` INT NOT NULL COMMENT '最大使用次数，0为不限制',
+    `used_count` INT NOT NULL COMMENT '已使用次数',
+    `expires_at` BIGINT NOT NULL COMMENT '过期时间戳 (毫秒)，0为永不过期',
+    `is_revoked` TINYINT(1) NOT NULL COMMENT '是否撤销，0为否，1为是',
+    `created_at` BIGINT NOT NULL COMMENT '创建时间戳 (毫秒)',
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`room_id`) REFERENCES `room`(`id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`creator_id`) REFERENCES `user`(`id`) ON DELETE CASCADE ON UPDATE CASCADE
+    ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+CREATE TABLE IF NOT EXISTS `room_join_request` (
+    `id` VARCHAR(255) NOT NULL COMMENT '申请ID',
+    `room_id` VARCHAR(255) NOT NULL,
+    `user_id` VARCHAR(255) NOT NULL,
+    `status` VARCHAR(32) NOT NULL COMMENT '申请状态：pending、approved、rejected',
+    `handled_by` VARCHAR(255) NOT NULL COMMENT '审核人ID，未审核为空',
+    `created_at` BIGINT NOT NULL COMMENT '创建时间戳 (毫秒)',
+    `handled_at` BIGINT NOT NULL COMMENT '审核时间戳 (毫秒)，未审核为0',
+    PRIMARY KEY (`id`),
+    KEY `idx_room_status` (`room_id`, `status`),
+    FOREIGN KEY (`room_id`) REFERENCES `room`(`id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES `user`(`id`) ON DELETE CASCADE ON UPDATE CASCADE
+    ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
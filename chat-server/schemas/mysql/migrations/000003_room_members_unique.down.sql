@@ -0,0 +1,4 @@
+-- user_id 的外键需要索引，删除唯一索引前先补上普通索引
+ALTER TABLE `room_members`
+    ADD KEY `idx_user_id` (`user_id`),
+    DROP INDEX `uk_user_room`;
@@ -0,0 +1,8 @@
+-- 房间成员按 (user_id, room_id) 唯一，并发加入、邀请和审核时不会重复添加同一成员
+-- 删除已存在的重复成员记录，保留最早加入的一条
+DELETE rm FROM `room_members` rm
+JOIN `room_members` earlier ON rm.`user_id` = earlier.`user_id` AND rm.`room_id` = earlier.`room_id`
+    AND (rm.`joined_at` > earlier.`joined_at` OR (rm.`joined_at` = earlier.`joined_at` AND rm.`id` > earlier.`id`));
+
+ALTER TABLE `room_members`
+    ADD UNIQUE KEY `uk_user_room` (`user_id`, `room_id`);
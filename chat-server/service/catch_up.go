@@ -0,0 +1,83 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/utils"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// catchUp 补发房间内 sinceSeq 之后的离线消息，由 WritePump 收到补发标记时调用，返回最后补发的序号
+// 订阅和投递实时消息都持有管理器的锁，补发标记之后投递的实时消息一定排在标记之后，
+// 之前的消息从 MongoDB 补发；消息是异步持久化的，缺少的序号会短暂等待后重新查询
+func (client *Client) catchUp(roomId string, sinceSeq int64) (int64, error) {
+	ctx := context.Background()
+	targetSeq, err := global.CHAT_REDIS.Get(ctx, roomSeqKey(roomId)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	lastSeq := sinceSeq
+	count := 0
+	hasMore := false
+	for retries := 0; ; {
+		page, err := ServiceGroupApp.MessageService.ResyncMessages(client.UserId, roomId, lastSeq+1, 0)
+		if err != nil {
+			return lastSeq, err
+		}
+		for _, msg := range page.Messages {
+			if msg.Seq <= lastSeq {
+				continue
+			}
+			if err := client.writeFrame(&WebSocketMessage{
+				ID:        msg.ID.Hex(),
+				Type:      msg.Type,
+				RoomId:    msg.RoomId,
+				SenderId:  msg.SenderId,
+				Content:   msg.Content,
+				CreatedAt: msg.CreatedAt,
+				Seq:       msg.Seq,
+			}); err != nil {
+				return lastSeq, err
+			}
+			lastSeq = msg.Seq
+			count++
+		}
+		if page.HasMore {
+			if count < constant.MaxCatchUpCount {
+				continue
+			}
+			hasMore = true
+			break
+		}
+		if lastSeq >= targetSeq || retries >= constant.CatchUpRetries {
+			break
+		}
+		retries++
+		time.Sleep(constant.CatchUpRetryInterval)
+	}
+
+	// 通知客户端补发结束，has_more 为true时客户端从 last_seq 之后继续 resync
+	err = client.writeFrame(&WebSocketMessage{
+		Type:     constant.MessageTypeCatchUp,
+		RoomId:   roomId,
+		SenderId: client.UserId,
+		Content: map[string]interface{}{
+			"since_seq": sinceSeq,
+			"last_seq":  lastSeq,
+			"count":     count,
+			"has_more":  hasMore,
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	})
+	return lastSeq, err
+}
+
+// alreadyReplayed 判断发送通道中的消息是否已经在补发时发送过，replayedSeq 为每个房间最后补发的序号
+func (client *Client) alreadyReplayed(message *WebSocketMessage, replayedSeq map[string]int64) bool {
+	return message.Seq > 0 && message.Seq <= replayedSeq[message.RoomId]
+}
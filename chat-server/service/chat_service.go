@@ -1,3 +1,77 @@
 package service
 
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
 type ChatService struct{}
+
+// SendDirectMessage 发送一对一私聊消息
+// 首次发送时创建私聊房间，消息持久化后投递到双方的所有连接
+func (s *ChatService) SendDirectMessage(fromUserId, toUserId, text string) (*model.UserMessages, error) {
+	if fromUserId == toUserId {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	// 校验接收者是否存在
+	if _, err := utils.GetUserByID(toUserId); err != nil {
+		return nil, err
+	}
+	room, err := ServiceGroupApp.RoomService.GetOrCreateDirectRoom(fromUserId, toUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	wsMessage := &WebSocketMessage{
+		Type:      constant.MessageTypeText,
+		RoomId:    room.ID,
+		SenderId:  fromUserId,
+		Content:   map[string]interface{}{"text": text},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}
+	content, isValid := validateUserMessage(wsMessage)
+	if !isValid {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+
+	manager, ok := global.CHAT_WEBSOCKET_MANAGER.(*WebSocketManager)
+	var mongoMsg model.UserMessages
+	deliver := func() error {
+		// 保存消息到mongoDB
+		messageId, _ := bson.ObjectIDFromHex(wsMessage.ID)
+		mongoMsg = model.UserMessages{
+			ID:        messageId,
+			RoomId:    wsMessage.RoomId,
+			SenderId:  wsMessage.SenderId,
+			Type:      wsMessage.Type,
+			Content:   content,
+			CreatedAt: wsMessage.CreatedAt,
+			Seq:       wsMessage.Seq,
+		}
+		if _, err := global.CHAT_MONGODB.Collection(userMessagesColl).InsertOne(context.Background(), mongoMsg); err != nil {
+			global.CHAT_LOG.Error("SendDirectMessage-->保存消息到MongoDB失败", "err", err)
+			return common.NewServiceError(common.ERROR)
+		}
+		// 投递到接收者和发送者其他设备的所有连接
+		if ok {
+			manager.SendToUsers(wsMessage, toUserId, fromUserId)
+		}
+		return nil
+	}
+	// 和房间广播共用房间锁，序号分配、保存和投递的顺序一致
+	if ok {
+		err = manager.sequenceAndDeliver(room.ID, wsMessage, deliver)
+	} else if err = assignRoomSeq(room.ID, wsMessage); err == nil {
+		err = deliver()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mongoMsg, nil
+}
@@ -7,4 +7,8 @@ type ServiceGroup struct {
 	UserService
 	MongoToEsSync
 	TokenService
+	RoomService
+	MessageService
+	SearchService
+	PresenceService
 }
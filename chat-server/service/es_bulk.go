@@ -0,0 +1,411 @@
+package service
+
+import (
+	"bytes"
+	"chat-server/global"
+	"chat-server/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	bulkActionIndex  = "index"
+	bulkActionDelete = "delete"
+
+	// 批量写入配置的默认值
+	defaultBulkBatchSize     = 500
+	defaultBulkBatchBytes    = 5 << 20
+	defaultBulkFlushInterval = time.Second
+	defaultBulkMaxRetries    = 5
+	defaultBulkRetryBackoff  = 200 * time.Millisecond
+	defaultDeadLetterColl    = "es_sync_dead_letters"
+)
+
+// bulkAction 单个待写入ES的操作，source 只在 index 时有值
+type bulkAction struct {
+	Action string
+	ID     string
+	Source []byte
+}
+
+// bulkFailure 最终写入失败的操作
+type bulkFailure struct {
+	Action bulkAction
+	Status int
+	Reason string
+}
+
+// DeadLetter 同步失败的文档，修复问题后可以重放
+type DeadLetter struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Collection string        `bson:"collection" json:"collection"`
+	EsIndex    string        `bson:"es_index" json:"es_index"`
+	DocumentID string        `bson:"document_id" json:"document_id"`
+	Action     string        `bson:"action" json:"action"`
+	Source     string        `bson:"source,omitempty" json:"source,omitempty"`
+	Status     int           `bson:"status" json:"status"`
+	Reason     string        `bson:"reason" json:"reason"`
+	Attempts   int           `bson:"attempts" json:"attempts"`
+	CreatedAt  int64         `bson:"created_at" json:"created_at"`
+	UpdatedAt  int64         `bson:"updated_at" json:"updated_at"`
+}
+
+// bulkBuffer 缓冲同步事件，达到数量、大小或时间阈值后通过 _bulk 写入ES
+type bulkBuffer struct {
+	collectionName string
+	esIndex        string
+	actions        []bulkAction
+	positions      map[string]int // 文档ID在 actions 中的位置
+	bytes          int
+	lastFlush      time.Time
+}
+
+func newBulkBuffer(collectionName string, esIndex string) *bulkBuffer {
+	return &bulkBuffer{collectionName: collectionName, esIndex: esIndex, lastFlush: time.Now()}
+}
+
+// Add 添加一个操作，同一批内同一文档只保留最后一个操作
+// 否则重试时较早的 index 操作可能覆盖同批内已成功的修改或删除
+func (b *bulkBuffer) Add(action bulkAction) {
+	if b.positions == nil {
+		b.positions = make(map[string]int)
+	}
+	if i, ok := b.positions[action.ID]; ok {
+		b.bytes += len(action.Source) - len(b.actions[i].Source)
+		b.actions[i] = action
+		return
+	}
+	b.positions[action.ID] = len(b.actions)
+	b.actions = append(b.actions, action)
+	b.bytes += len(action.Source)
+}
+
+// ShouldFlush 判断是否达到刷新阈值
+func (b *bulkBuffer) ShouldFlush() bool {
+	if len(b.actions) == 0 {
+		return false
+	}
+	cfg := bulkConfig()
+	return len(b.actions) >= cfg.batchSize || b.bytes >= cfg.batchBytes || time.Since(b.lastFlush) >= cfg.flushInterval
+}
+
+// Flush 写入缓冲的所有操作，最终失败的操作写入死信集合
+func (b *bulkBuffer) Flush(ctx context.Context) {
+	b.lastFlush = time.Now()
+	if len(b.actions) == 0 {
+		return
+	}
+	actions := b.actions
+	b.actions = nil
+	b.positions = nil
+	b.bytes = 0
+
+	failures := bulkWrite(ctx, b.esIndex, actions)
+	slog.Info(fmt.Sprintf("ES 索引 %s 批量同步完成 (Collection: %s)", b.esIndex, b.collectionName), "total", len(actions), "failed", len(failures))
+	if len(failures) > 0 {
+		saveDeadLetters(ctx, b.collectionName, b.esIndex, failures)
+	}
+}
+
+// bulkWrite 通过 _bulk 写入一批操作，整体请求或单个操作遇到 429/5xx 时指数退避重试
+// 返回最终失败的操作，其他 4xx 错误(如 strict mapping 拒绝)不重试
+func bulkWrite(ctx context.Context, esIndex string, actions []bulkAction) []bulkFailure {
+	cfg := bulkConfig()
+	var failures []bulkFailure
+	pending := actions
+	backoff := cfg.retryBackoff
+	lastStatus, lastReason := 0, ""
+
+retryLoop:
+	for attempt := 0; attempt <= cfg.maxRetries && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				lastReason = ctx.Err().Error()
+				break retryLoop
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		statuses, reasons, status, err := sendBulk(ctx, esIndex, pending)
+		if err != nil || statuses == nil {
+			reason := ""
+			if err != nil {
+				reason = err.Error()
+			} else {
+				reason = reasons[0]
+			}
+			if err == nil && !isRetryableStatus(status) {
+				// 请求整体被拒绝且不可重试
+				for _, action := range pending {
+					failures = append(failures, bulkFailure{Action: action, Status: status, Reason: reason})
+				}
+				return failures
+			}
+			lastStatus, lastReason = status, reason
+			slog.Warn(fmt.Sprintf("ES 索引 %s 批量请求失败，准备重试", esIndex), "attempt", attempt+1, "status", status, "reason", reason)
+			continue
+		}
+
+		var retry []bulkAction
+		for i, action := range pending {
+			switch {
+			case statuses[i] >= 200 && statuses[i] < 300:
+			case action.Action == bulkActionDelete && statuses[i] == http.StatusNotFound:
+				// 删除不存在的文档视为成功
+			case isRetryableStatus(statuses[i]):
+				retry = append(retry, action)
+				lastStatus, lastReason = statuses[i], reasons[i]
+			default:
+				failures = append(failures, bulkFailure{Action: action, Status: statuses[i], Reason: reasons[i]})
+			}
+		}
+		pending = retry
+	}
+
+	for _, action := range pending {
+		failures = append(failures, bulkFailure{Action: action, Status: lastStatus, Reason: "重试次数耗尽: " + lastReason})
+	}
+	return failures
+}
+
+// sendBulk 发送一次 _bulk 请求，返回每个操作的状态码和错误原因
+// 请求整体失败时 statuses 为nil，reasons[0] 为错误原因
+func sendBulk(ctx context.Context, esIndex string, actions []bulkAction) ([]int, []string, int, error) {
+	var body bytes.Buffer
+	for _, action := range actions {
+		meta, _ := json.Marshal(map[string]interface{}{action.Action: map[string]string{"_id": action.ID}})
+		body.Write(meta)
+		body.WriteByte('\n')
+		if action.Action == bulkActionIndex {
+			body.Write(action.Source)
+			body.WriteByte('\n')
+		}
+	}
+
+	res, err := global.CHAT_ES.Bulk(&body,
+		global.CHAT_ES.Bulk.WithIndex(esIndex),
+		global.CHAT_ES.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, []string{res.String()}, res.StatusCode, nil
+	}
+
+	var bulkRes struct {
+		Items []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&bulkRes); err != nil {
+		return nil, nil, res.StatusCode, fmt.Errorf("解析 _bulk 响应失败: %w", err)
+	}
+	if len(bulkRes.Items) != len(actions) {
+		return nil, nil, res.StatusCode, fmt.Errorf("_bulk 响应条数 %d 与请求条数 %d 不一致", len(bulkRes.Items), len(actions))
+	}
+
+	statuses := make([]int, len(actions))
+	reasons := make([]string, len(actions))
+	for i, item := range bulkRes.Items {
+		for _, result := range item {
+			statuses[i] = result.Status
+			reasons[i] = string(result.Error)
+		}
+	}
+	return statuses, reasons, res.StatusCode, nil
+}
+
+// isRetryableStatus 429 和 5xx 可以重试
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// saveDeadLetters 把最终失败的操作写入死信集合
+func saveDeadLetters(ctx context.Context, collectionName string, esIndex string, failures []bulkFailure) {
+	now := utils.GetUTCMillisTimestamp()
+	docs := make([]interface{}, 0, len(failures))
+	for _, failure := range failures {
+		docs = append(docs, DeadLetter{
+			Collection: collectionName,
+			EsIndex:    esIndex,
+			DocumentID: failure.Action.ID,
+			Action:     failure.Action.Action,
+			Source:     string(failure.Action.Source),
+			Status:     failure.Status,
+			Reason:     failure.Reason,
+			Attempts:   1,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		slog.Error(fmt.Sprintf("ES 索引 %s 文档同步失败，写入死信集合 (Collection: %s)", esIndex, collectionName),
+			"文档ID:", failure.Action.ID, "status", failure.Status, "reason", failure.Reason)
+	}
+	if _, err := global.CHAT_MONGODB.Collection(bulkConfig().deadLetterColl).InsertMany(context.WithoutCancel(ctx), docs); err != nil {
+		slog.Error(fmt.Sprintf("写入死信集合失败 (Collection: %s)", collectionName), "err", err, "count", len(docs))
+	}
+}
+
+// bulkSettings 补全默认值后的批量写入配置
+type bulkSettings struct {
+	batchSize      int
+	batchBytes     int
+	flushInterval  time.Duration
+	maxRetries     int
+	retryBackoff   time.Duration
+	deadLetterColl string
+}
+
+func bulkConfig() bulkSettings {
+	cfg := global.CHAT_CONFIG.MongoEsBulk
+	settings := bulkSettings{
+		batchSize:      cfg.BatchSize,
+		batchBytes:     cfg.BatchBytes,
+		flushInterval:  time.Duration(cfg.FlushInterval) * time.Millisecond,
+		maxRetries:     cfg.MaxRetries,
+		retryBackoff:   time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		deadLetterColl: cfg.DeadLetterCollection,
+	}
+	if settings.batchSize <= 0 {
+		settings.batchSize = defaultBulkBatchSize
+	}
+	if settings.batchBytes <= 0 {
+		settings.batchBytes = defaultBulkBatchBytes
+	}
+	if settings.flushInterval <= 0 {
+		settings.flushInterval = defaultBulkFlushInterval
+	}
+	if settings.maxRetries <= 0 {
+		settings.maxRetries = defaultBulkMaxRetries
+	}
+	if settings.retryBackoff <= 0 {
+		settings.retryBackoff = defaultBulkRetryBackoff
+	}
+	if settings.deadLetterColl == "" {
+		settings.deadLetterColl = defaultDeadLetterColl
+	}
+	return settings
+}
+
+// ReplayDeadLetters 重放死信集合中的所有文档，以 Mongo 中的当前状态为准重新写入或删除ES文档
+// 成功的死信被删除，仍然失败的死信更新重试次数和原因
+func (s *MongoToEsSync) ReplayDeadLetters(ctx context.Context) (replayed int, failed int, err error) {
+	cfg := bulkConfig()
+	deadLetterColl := global.CHAT_MONGODB.Collection(cfg.deadLetterColl)
+	cursor, err := deadLetterColl.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, 0, fmt.Errorf("查询死信集合失败: %w", err)
+	}
+	var letters []DeadLetter
+	if err := cursor.All(ctx, &letters); err != nil {
+		return 0, 0, fmt.Errorf("解码死信失败: %w", err)
+	}
+
+	// 同一文档只需要按当前状态重放一次，按ES索引分组批量写入
+	type target struct{ collection, documentID string }
+	letterIds := make(map[string]map[target][]bson.ObjectID)
+	targets := make(map[string][]target)
+	var indices []string
+	for _, letter := range letters {
+		if _, ok := letterIds[letter.EsIndex]; !ok {
+			letterIds[letter.EsIndex] = make(map[target][]bson.ObjectID)
+			indices = append(indices, letter.EsIndex)
+		}
+		t := target{letter.Collection, letter.DocumentID}
+		if _, ok := letterIds[letter.EsIndex][t]; !ok {
+			targets[letter.EsIndex] = append(targets[letter.EsIndex], t)
+		}
+		letterIds[letter.EsIndex][t] = append(letterIds[letter.EsIndex][t], letter.ID)
+	}
+
+	for _, esIndex := range indices {
+		indexTargets := targets[esIndex]
+		for start := 0; start < len(indexTargets); start += cfg.batchSize {
+			batch := indexTargets[start:min(start+cfg.batchSize, len(indexTargets))]
+			actions := make([]bulkAction, 0, len(batch))
+			for _, t := range batch {
+				action, err := currentDocumentAction(ctx, t.collection, t.documentID)
+				if err != nil {
+					return replayed, failed, err
+				}
+				actions = append(actions, action)
+			}
+
+			failures := make(map[string]bulkFailure)
+			for _, failure := range bulkWrite(ctx, esIndex, actions) {
+				failures[failure.Action.ID] = failure
+			}
+			var succeeded []bson.ObjectID
+			for _, t := range batch {
+				ids := letterIds[esIndex][t]
+				failure, ok := failures[t.documentID]
+				if !ok {
+					succeeded = append(succeeded, ids...)
+					continue
+				}
+				failed += len(ids)
+				_, err := deadLetterColl.UpdateMany(ctx,
+					bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}},
+					bson.D{
+						{Key: "$set", Value: bson.D{{Key: "status", Value: failure.Status}, {Key: "reason", Value: failure.Reason}, {Key: "updated_at", Value: utils.GetUTCMillisTimestamp()}}},
+						{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+					})
+				if err != nil {
+					return replayed, failed, fmt.Errorf("更新死信失败: %w", err)
+				}
+			}
+			if len(succeeded) > 0 {
+				if _, err := deadLetterColl.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: succeeded}}}}); err != nil {
+					return replayed, failed, fmt.Errorf("删除已重放的死信失败: %w", err)
+				}
+				replayed += len(succeeded)
+			}
+		}
+	}
+	slog.Info("死信重放完成", "replayed", replayed, "failed", failed)
+	return replayed, failed, nil
+}
+
+// currentDocumentAction 根据 Mongo 中文档的当前状态生成ES操作，文档已不存在时删除
+func currentDocumentAction(ctx context.Context, collectionName string, documentId string) (bulkAction, error) {
+	var mongoId interface{} = documentId
+	if id, err := bson.ObjectIDFromHex(documentId); err == nil {
+		mongoId = id
+	}
+	var document bson.M
+	err := global.CHAT_MONGODB.Collection(collectionName).FindOne(ctx, bson.D{{Key: "_id", Value: mongoId}}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return bulkAction{Action: bulkActionDelete, ID: documentId}, nil
+	}
+	if err != nil {
+		return bulkAction{}, fmt.Errorf("查询集合 %s 文档 %s 失败: %w", collectionName, documentId, err)
+	}
+	return newIndexAction(collectionName, document)
+}
+
+// newIndexAction 把 Mongo 文档转换为ES写入操作，文档id使用 Mongo 的 _id
+func newIndexAction(collectionName string, document bson.M) (bulkAction, error) {
+	//先获取id，再把文档里的_id删掉，不然写入es的时候就会多一个_id
+	id := documentID(collectionName, document["_id"])
+	delete(document, "_id")
+
+	//把文档转换为json，为了写入es
+	jsonDocument, err := json.Marshal(document)
+	if err != nil {
+		return bulkAction{}, fmt.Errorf("document 到 JSON 失败 (ID: %s): %w", id, err)
+	}
+	return bulkAction{Action: bulkActionIndex, ID: id, Source: jsonDocument}, nil
+}
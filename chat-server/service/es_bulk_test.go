@@ -0,0 +1,77 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBulkBufferAdd(t *testing.T) {
+	tests := []struct {
+		name      string
+		added     []bulkAction
+		want      []bulkAction
+		wantBytes int
+	}{
+		{
+			name: "不同文档按添加顺序保留",
+			added: []bulkAction{
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":1}`)},
+				{Action: bulkActionIndex, ID: "b", Source: []byte(`{"v":22}`)},
+			},
+			want: []bulkAction{
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":1}`)},
+				{Action: bulkActionIndex, ID: "b", Source: []byte(`{"v":22}`)},
+			},
+			wantBytes: 15,
+		},
+		{
+			name: "同一文档先索引后删除只保留删除",
+			added: []bulkAction{
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":1}`)},
+				{Action: bulkActionDelete, ID: "a"},
+			},
+			want: []bulkAction{
+				{Action: bulkActionDelete, ID: "a"},
+			},
+			wantBytes: 0,
+		},
+		{
+			name: "同一文档多次索引只保留最后一次",
+			added: []bulkAction{
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":1}`)},
+				{Action: bulkActionIndex, ID: "b", Source: []byte(`{"v":2}`)},
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":333}`)},
+			},
+			want: []bulkAction{
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":333}`)},
+				{Action: bulkActionIndex, ID: "b", Source: []byte(`{"v":2}`)},
+			},
+			wantBytes: 16,
+		},
+		{
+			name: "删除后重新索引只保留索引",
+			added: []bulkAction{
+				{Action: bulkActionDelete, ID: "a"},
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":1}`)},
+			},
+			want: []bulkAction{
+				{Action: bulkActionIndex, ID: "a", Source: []byte(`{"v":1}`)},
+			},
+			wantBytes: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := newBulkBuffer("messages", "messages")
+			for _, action := range tt.added {
+				buffer.Add(action)
+			}
+			if !reflect.DeepEqual(buffer.actions, tt.want) {
+				t.Errorf("actions = %+v, want %+v", buffer.actions, tt.want)
+			}
+			if buffer.bytes != tt.wantBytes {
+				t.Errorf("bytes = %d, want %d", buffer.bytes, tt.wantBytes)
+			}
+		})
+	}
+}
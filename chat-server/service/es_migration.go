@@ -0,0 +1,170 @@
+package service
+
+import (
+	"chat-server/config"
+	"chat-server/global"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// EnsureIndex 保证别名指向的索引与请求体文件中的映射一致
+// 别名不存在时创建第一个版本；映射漂移或仍是别名引入前的真实索引时，开启 auto_migrate 则重建并切换别名
+// 切换前搜索一直使用旧索引，不会中断
+func (s *MongoToEsSync) EnsureIndex(ctx context.Context, indexCfg config.ElasticsearchIndexSchema) error {
+	alias := indexCfg.Name
+	requestBytes, err := readIndexRequest(indexCfg)
+	if err != nil {
+		return err
+	}
+	indices, concrete, err := aliasIndices(ctx, alias)
+	if err != nil {
+		return err
+	}
+
+	if len(indices) == 0 {
+		newIndex := versionedIndexName(alias)
+		slog.Info(fmt.Sprintf("ES 索引 '%s' 不存在，创建索引 %s 并设置别名", alias, newIndex))
+		if err := createIndex(ctx, newIndex, requestBytes); err != nil {
+			return err
+		}
+		if _, err := swapAlias(ctx, alias, newIndex); err != nil {
+			return err
+		}
+		return nil
+	}
+	// 别名指向多个索引时搜索会命中所有索引，逐个检查，任何一个漂移都需要迁移
+	var drifted []string
+	for _, index := range indices {
+		drift, err := mappingDrift(ctx, index, requestBytes)
+		if err != nil {
+			return err
+		}
+		if drift {
+			drifted = append(drifted, index)
+		}
+	}
+	if len(drifted) == 0 && !concrete {
+		slog.Info(fmt.Sprintf("ES 索引 '%s' 已存在 (%s)，映射与文件一致。", alias, strings.Join(indices, ", ")))
+		return nil
+	}
+	if len(drifted) > 0 {
+		slog.Warn(fmt.Sprintf("ES 索引 '%s' (%s) 的映射与请求体文件不一致", alias, strings.Join(drifted, ", ")))
+	} else {
+		slog.Warn(fmt.Sprintf("ES 索引 '%s' 是真实索引，需要迁移到版本索引和别名", alias))
+	}
+	if !indexCfg.AutoMigrate {
+		slog.Warn(fmt.Sprintf("ES 索引 '%s' 未开启 auto_migrate，请执行 reindex 子命令迁移", alias))
+		return nil
+	}
+
+	collectionName := syncCollection(alias)
+	if collectionName == "" {
+		return fmt.Errorf("ES 索引 '%s' 需要迁移，但 mongo_es_sync 中没有对应的集合", alias)
+	}
+	newIndex, err := s.Reindex(ctx, collectionName, alias, false)
+	if err != nil {
+		return fmt.Errorf("迁移 ES 索引 '%s' 失败: %w", alias, err)
+	}
+	slog.Info(fmt.Sprintf("ES 索引 '%s' 迁移完成，当前指向 %s，旧索引保留用于回滚", alias, newIndex))
+	return nil
+}
+
+// mappingDrift 比较索引的线上映射和请求体文件中的映射是否不同
+func mappingDrift(ctx context.Context, index string, requestBytes []byte) (bool, error) {
+	var request struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.Unmarshal(requestBytes, &request); err != nil {
+		return false, fmt.Errorf("解析 ES 索引 '%s' 请求体失败: %w", index, err)
+	}
+
+	res, err := global.CHAT_ES.Indices.GetMapping(
+		global.CHAT_ES.Indices.GetMapping.WithIndex(index),
+		global.CHAT_ES.Indices.GetMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return false, fmt.Errorf("获取 ES 索引 '%s' 映射失败: %w", index, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return false, fmt.Errorf("获取 ES 索引 '%s' 映射失败 (ES 响应错误): %s", index, res.String())
+	}
+	var live map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&live); err != nil {
+		return false, fmt.Errorf("解析 ES 索引 '%s' 映射失败: %w", index, err)
+	}
+
+	return !mappingCovers(normalizeMapping(request.Mappings), normalizeMapping(live[index].Mappings)), nil
+}
+
+// mappingCovers 判断线上映射是否包含文件中声明的全部字段和参数
+// 只比较文件中声明的部分，ES 返回时补充的默认参数和动态添加的字段不算漂移
+func mappingCovers(declared, live interface{}) bool {
+	switch d := declared.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range d {
+			liveValue, exists := l[key]
+			if !exists || !mappingCovers(value, liveValue) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !mappingCovers(d[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		// ES 返回的部分参数会变成字符串(如 dynamic: false 返回 "false")，按字符串形式比较
+		return fmt.Sprint(declared) == fmt.Sprint(live)
+	}
+}
+
+// normalizeMapping 去掉ES返回映射时会省略的默认值，使文件和线上映射可以直接比较
+// 有 properties 的字段默认就是 object 类型
+func normalizeMapping(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = normalizeMapping(item)
+		}
+		if _, ok := result["properties"]; ok && result["type"] == "object" {
+			delete(result, "type")
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalizeMapping(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// syncCollection 根据 mongo_es_sync 配置查找索引对应的集合
+func syncCollection(esIndex string) string {
+	for _, pair := range global.CHAT_CONFIG.MongoEsSync {
+		if pair.EsIndex == esIndex {
+			return pair.MongoCollection
+		}
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decodeMapping 把 JSON 字符串解码为和 ES 响应一致的映射结构
+func decodeMapping(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var mapping map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &mapping); err != nil {
+		t.Fatalf("解析映射失败: %v", err)
+	}
+	return mapping
+}
+
+func TestNormalizeMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		want    string
+	}{
+		{
+			name:    "有 properties 的 object 类型去掉 type",
+			mapping: `{"properties":{"content":{"type":"object","properties":{"text":{"type":"text"}}}}}`,
+			want:    `{"properties":{"content":{"properties":{"text":{"type":"text"}}}}}`,
+		},
+		{
+			name:    "没有 properties 的 object 类型保留 type",
+			mapping: `{"properties":{"meta":{"type":"object","enabled":false}}}`,
+			want:    `{"properties":{"meta":{"type":"object","enabled":false}}}`,
+		},
+		{
+			name:    "nested 类型保留 type",
+			mapping: `{"properties":{"reactions":{"type":"nested","properties":{"emoji":{"type":"keyword"}}}}}`,
+			want:    `{"properties":{"reactions":{"type":"nested","properties":{"emoji":{"type":"keyword"}}}}}`,
+		},
+		{
+			name:    "数组中的映射也会处理",
+			mapping: `{"dynamic_templates":[{"strings":{"mapping":{"type":"object","properties":{}}}}]}`,
+			want:    `{"dynamic_templates":[{"strings":{"mapping":{"properties":{}}}}]}`,
+		},
+		{
+			name:    "其他字段原样保留",
+			mapping: `{"dynamic":"strict","properties":{"created_at":{"type":"long"}}}`,
+			want:    `{"dynamic":"strict","properties":{"created_at":{"type":"long"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeMapping(decodeMapping(t, tt.mapping))
+			if want := decodeMapping(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("normalizeMapping() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMappingKeepsInput(t *testing.T) {
+	mapping := decodeMapping(t, `{"properties":{"content":{"type":"object","properties":{}}}}`)
+	normalizeMapping(mapping)
+	content := mapping["properties"].(map[string]interface{})["content"].(map[string]interface{})
+	if content["type"] != "object" {
+		t.Errorf("normalizeMapping 修改了原映射: %v", mapping)
+	}
+}
+
+func TestMappingCovers(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		live     string
+		want     bool
+	}{
+		{
+			name:     "完全一致",
+			declared: `{"properties":{"text":{"type":"text","analyzer":"ik_max_word"}}}`,
+			live:     `{"properties":{"text":{"type":"text","analyzer":"ik_max_word"}}}`,
+			want:     true,
+		},
+		{
+			name:     "ES 补充的默认参数不算漂移",
+			declared: `{"properties":{"room_id":{"type":"keyword"}}}`,
+			live:     `{"properties":{"room_id":{"type":"keyword","ignore_above":256,"index":true}}}`,
+			want:     true,
+		},
+		{
+			name:     "动态添加的字段不算漂移",
+			declared: `{"properties":{"room_id":{"type":"keyword"}}}`,
+			live:     `{"properties":{"room_id":{"type":"keyword"},"extra":{"type":"text"}}}`,
+			want:     true,
+		},
+		{
+			name:     "字段类型不同",
+			declared: `{"properties":{"created_at":{"type":"date"}}}`,
+			live:     `{"properties":{"created_at":{"type":"long"}}}`,
+			want:     false,
+		},
+		{
+			name:     "声明的字段不存在",
+			declared: `{"properties":{"seq":{"type":"long"}}}`,
+			live:     `{"properties":{"room_id":{"type":"keyword"}}}`,
+			want:     false,
+		},
+		{
+			name:     "声明的参数不同",
+			declared: `{"properties":{"text":{"type":"text","analyzer":"ik_smart"}}}`,
+			live:     `{"properties":{"text":{"type":"text","analyzer":"standard"}}}`,
+			want:     false,
+		},
+		{
+			name:     "ES 以字符串返回的参数",
+			declared: `{"dynamic":false,"properties":{}}`,
+			live:     `{"dynamic":"false","properties":{}}`,
+			want:     true,
+		},
+		{
+			name:     "声明的对象在线上是普通值",
+			declared: `{"properties":{"content":{"properties":{"text":{"type":"text"}}}}}`,
+			live:     `{"properties":{"content":"text"}}`,
+			want:     false,
+		},
+		{
+			name:     "数组按顺序比较",
+			declared: `{"properties":{"text":{"type":"text","copy_to":["all","full"]}}}`,
+			live:     `{"properties":{"text":{"type":"text","copy_to":["full","all"]}}}`,
+			want:     false,
+		},
+		{
+			name:     "数组长度不同",
+			declared: `{"properties":{"text":{"type":"text","copy_to":["all"]}}}`,
+			live:     `{"properties":{"text":{"type":"text","copy_to":["all","full"]}}}`,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			declared := normalizeMapping(decodeMapping(t, tt.declared))
+			live := normalizeMapping(decodeMapping(t, tt.live))
+			if got := mappingCovers(declared, live); got != tt.want {
+				t.Errorf("mappingCovers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
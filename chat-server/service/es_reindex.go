@@ -0,0 +1,331 @@
+package service
+
+import (
+	"bytes"
+	"chat-server/config"
+	"chat-server/global"
+	"chat-server/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Reindex 把集合的全部文档写入新的版本索引，然后原子地把别名切换到新索引
+// 扫描期间打开 Change Stream，切换前后各追平一次，保证扫描和切换期间的变更不丢失
+// 返回新索引名；deleteOld 为true时删除别名原来指向的索引，否则旧索引保留用于回滚
+func (s *MongoToEsSync) Reindex(ctx context.Context, collectionName string, alias string, deleteOld bool) (_ string, err error) {
+	requestBytes, err := indexRequestBody(alias)
+	if err != nil {
+		return "", err
+	}
+	newIndex := versionedIndexName(alias)
+	if err := createIndex(ctx, newIndex, requestBytes); err != nil {
+		return "", err
+	}
+	// 切换别名之前失败时删除建了一半的新索引，别名仍指向旧索引
+	swapped := false
+	defer func() {
+		if err == nil || swapped {
+			return
+		}
+		if deleteErr := deleteIndex(context.Background(), newIndex); deleteErr != nil {
+			slog.Error(fmt.Sprintf("删除未完成的 ES 索引 '%s' 失败", newIndex), "err", deleteErr)
+		}
+	}()
+	slog.Info(fmt.Sprintf("开始重建 ES 索引 (Collection: %s, Alias: %s, Index: %s)", collectionName, alias, newIndex))
+
+	// 先打开监听再扫描，扫描期间的变更由监听补上
+	watch, err := global.CHAT_MONGODB.Collection(collectionName).Watch(ctx, mongo.Pipeline{},
+		options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return "", fmt.Errorf("监听集合 %s 失败: %w", collectionName, err)
+	}
+	defer watch.Close(context.Background())
+
+	buffer := newBulkBuffer(collectionName, newIndex)
+	cursor, err := global.CHAT_MONGODB.Collection(collectionName).Find(ctx, bson.D{})
+	if err != nil {
+		return "", fmt.Errorf("查询集合 %s 失败: %w", collectionName, err)
+	}
+	count := 0
+	for cursor.Next(ctx) {
+		var document bson.M
+		if err := cursor.Decode(&document); err != nil {
+			slog.Error(fmt.Sprintf("重建索引解码文档失败 (Collection: %s):", collectionName), "err", err)
+			continue
+		}
+		action, err := newIndexAction(collectionName, document)
+		if err != nil {
+			slog.Error(fmt.Sprintf("重建索引转换 ES 文档失败 (Collection: %s):", collectionName), "err", err)
+			continue
+		}
+		buffer.Add(action)
+		count++
+		if buffer.ShouldFlush() {
+			buffer.Flush(ctx)
+		}
+	}
+	cursorErr := cursor.Err()
+	cursor.Close(context.Background())
+	if cursorErr != nil {
+		return "", fmt.Errorf("遍历集合 %s 失败: %w", collectionName, cursorErr)
+	}
+	buffer.Flush(ctx)
+	slog.Info(fmt.Sprintf("重建索引扫描完成 (Collection: %s, Index: %s)", collectionName, newIndex), "documents", count)
+
+	if err := s.drainChanges(ctx, watch, buffer, collectionName); err != nil {
+		return "", err
+	}
+	oldIndices, err := swapAlias(ctx, alias, newIndex)
+	if err != nil {
+		return "", err
+	}
+	swapped = true
+	// 切换前实时同步写入的是旧索引，再追平一次
+	if err := s.drainChanges(ctx, watch, buffer, collectionName); err != nil {
+		return "", err
+	}
+	slog.Info(fmt.Sprintf("ES 别名 %s 已切换到索引 %s", alias, newIndex), "old_indices", oldIndices)
+
+	if deleteOld {
+		for _, oldIndex := range oldIndices {
+			if err := deleteIndex(ctx, oldIndex); err != nil {
+				return newIndex, err
+			}
+		}
+	}
+	return newIndex, nil
+}
+
+// drainChanges 把 Change Stream 中已有的事件全部写入缓冲区并刷新
+func (s *MongoToEsSync) drainChanges(ctx context.Context, watch *mongo.ChangeStream, buffer *bulkBuffer, collectionName string) error {
+	for watch.TryNext(ctx) {
+		var event changeEvent
+		if err := watch.Decode(&event); err != nil {
+			slog.Error(fmt.Sprintf("解码 Change Stream 事件失败 (Collection: %s):", collectionName), "err", err)
+			continue
+		}
+		s.bufferEvent(buffer, collectionName, event)
+		if buffer.ShouldFlush() {
+			buffer.Flush(ctx)
+		}
+	}
+	if err := watch.Err(); err != nil {
+		return fmt.Errorf("追平集合 %s 变更失败: %w", collectionName, err)
+	}
+	buffer.Flush(ctx)
+	return nil
+}
+
+// indexRequestBody 读取 db_schema.elasticsearch 中配置的索引创建请求体
+func indexRequestBody(alias string) ([]byte, error) {
+	if global.CHAT_CONFIG.DBSchema.Elasticsearch != nil {
+		for _, indexCfg := range global.CHAT_CONFIG.DBSchema.Elasticsearch.Indices {
+			if indexCfg.Name == alias {
+				return readIndexRequest(indexCfg)
+			}
+		}
+	}
+	return nil, fmt.Errorf("db_schema.elasticsearch 中没有索引 '%s' 的配置", alias)
+}
+
+// readIndexRequest 读取索引创建请求体文件
+func readIndexRequest(indexCfg config.ElasticsearchIndexSchema) ([]byte, error) {
+	requestBytes, err := os.ReadFile(indexCfg.RequestFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取 ES 索引 '%s' 请求体文件 '%s' 失败: %w", indexCfg.Name, indexCfg.RequestFile, err)
+	}
+	return requestBytes, nil
+}
+
+// versionedIndexName 生成别名对应的版本索引名
+func versionedIndexName(alias string) string {
+	return fmt.Sprintf("%s_v%d", alias, utils.GetUTCMillisTimestamp())
+}
+
+// createIndex 创建索引
+func createIndex(ctx context.Context, name string, requestBytes []byte) error {
+	res, err := global.CHAT_ES.Indices.Create(name,
+		global.CHAT_ES.Indices.Create.WithBody(bytes.NewReader(requestBytes)),
+		global.CHAT_ES.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("创建 ES 索引 '%s' 失败: %w", name, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("创建 ES 索引 '%s' 失败 (ES 响应错误): %s", name, res.String())
+	}
+	return nil
+}
+
+// deleteIndex 删除索引
+func deleteIndex(ctx context.Context, name string) error {
+	res, err := global.CHAT_ES.Indices.Delete([]string{name}, global.CHAT_ES.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("删除 ES 索引 '%s' 失败: %w", name, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("删除 ES 索引 '%s' 失败 (ES 响应错误): %s", name, res.String())
+	}
+	slog.Info(fmt.Sprintf("ES 索引 '%s' 已删除", name))
+	return nil
+}
+
+// aliasIndices 查询别名指向的索引，按名称排序；concrete 为true表示该名称是一个真实索引而不是别名
+func aliasIndices(ctx context.Context, alias string) (indices []string, concrete bool, err error) {
+	res, err := global.CHAT_ES.Indices.Get([]string{alias}, global.CHAT_ES.Indices.Get.WithContext(ctx))
+	if err != nil {
+		return nil, false, fmt.Errorf("查询 ES 索引 '%s' 失败: %w", alias, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if res.IsError() {
+		return nil, false, fmt.Errorf("查询 ES 索引 '%s' 失败 (ES 响应错误): %s", alias, res.String())
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, false, fmt.Errorf("解析 ES 索引 '%s' 信息失败: %w", alias, err)
+	}
+	for name := range body {
+		if name == alias {
+			concrete = true
+		}
+		indices = append(indices, name)
+	}
+	sort.Strings(indices)
+	return indices, concrete, nil
+}
+
+// swapAlias 在一次 _aliases 请求中把别名从旧索引移到新索引，返回旧索引，旧索引只移除别名不删除，保留用于回滚
+// 同名的真实索引(别名引入之前创建的)无法和别名共存，先克隆为备份索引再在同一请求中删除，备份索引作为旧索引返回
+func swapAlias(ctx context.Context, alias string, newIndex string) ([]string, error) {
+	oldIndices, concrete, err := aliasIndices(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	actions := []interface{}{
+		map[string]interface{}{"add": map[string]interface{}{"index": newIndex, "alias": alias, "is_write_index": true}},
+	}
+	var removed []string
+	var backup string
+	if concrete {
+		slog.Warn(fmt.Sprintf("ES 索引 '%s' 是真实索引，克隆为备份索引后切换别名", alias))
+		if backup, err = cloneConcreteIndex(ctx, alias); err != nil {
+			return nil, err
+		}
+		actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": alias}})
+		removed = append(removed, backup)
+	} else {
+		for _, oldIndex := range oldIndices {
+			if oldIndex == newIndex {
+				continue
+			}
+			actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": oldIndex, "alias": alias}})
+			removed = append(removed, oldIndex)
+		}
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"actions": actions})
+	res, err := global.CHAT_ES.Indices.UpdateAliases(bytes.NewReader(body), global.CHAT_ES.Indices.UpdateAliases.WithContext(ctx))
+	if err == nil {
+		defer res.Body.Close()
+		if res.IsError() {
+			err = fmt.Errorf("ES 响应错误: %s", res.String())
+		}
+	}
+	if err != nil {
+		if backup != "" {
+			// 真实索引没有删除，恢复写入并删除备份
+			if unblockErr := setWriteBlock(ctx, alias, false); unblockErr != nil {
+				slog.Error(fmt.Sprintf("恢复 ES 索引 '%s' 写入失败", alias), "err", unblockErr)
+			}
+			if deleteErr := deleteIndex(ctx, backup); deleteErr != nil {
+				slog.Error(fmt.Sprintf("删除 ES 备份索引 '%s' 失败", backup), "err", deleteErr)
+			}
+		}
+		return nil, fmt.Errorf("切换 ES 别名 '%s' 失败: %w", alias, err)
+	}
+	return removed, nil
+}
+
+// cloneConcreteIndex 把真实索引克隆为备份索引，克隆前需要禁止写入，备份索引保持只读
+// 禁止写入期间实时同步写入失败的变更由重建索引的 Change Stream 在切换后追平
+func cloneConcreteIndex(ctx context.Context, index string) (string, error) {
+	backup := fmt.Sprintf("%s_legacy_%d", index, utils.GetUTCMillisTimestamp())
+	if err := setWriteBlock(ctx, index, true); err != nil {
+		return "", err
+	}
+	res, err := global.CHAT_ES.Indices.Clone(index, backup, global.CHAT_ES.Indices.Clone.WithContext(ctx))
+	if err == nil {
+		defer res.Body.Close()
+		if res.IsError() {
+			err = fmt.Errorf("ES 响应错误: %s", res.String())
+		}
+	}
+	if err != nil {
+		if unblockErr := setWriteBlock(ctx, index, false); unblockErr != nil {
+			slog.Error(fmt.Sprintf("恢复 ES 索引 '%s' 写入失败", index), "err", unblockErr)
+		}
+		return "", fmt.Errorf("克隆 ES 索引 '%s' 到 '%s' 失败: %w", index, backup, err)
+	}
+	slog.Info(fmt.Sprintf("ES 索引 '%s' 已克隆为备份索引 '%s'", index, backup))
+	return backup, nil
+}
+
+// setWriteBlock 禁止或恢复索引写入
+func setWriteBlock(ctx context.Context, index string, blocked bool) error {
+	var value interface{}
+	if blocked {
+		value = true
+	}
+	body, _ := json.Marshal(map[string]interface{}{"index.blocks.write": value})
+	res, err := global.CHAT_ES.Indices.PutSettings(bytes.NewReader(body),
+		global.CHAT_ES.Indices.PutSettings.WithIndex(index),
+		global.CHAT_ES.Indices.PutSettings.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("更新 ES 索引 '%s' 写入设置失败: %w", index, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("更新 ES 索引 '%s' 写入设置失败 (ES 响应错误): %s", index, res.String())
+	}
+	return nil
+}
+
+// ReindexAll 重建所有 mongo_es_sync 配置的索引，indices 不为空时只重建指定的索引
+func (s *MongoToEsSync) ReindexAll(ctx context.Context, indices []string, deleteOld bool) error {
+	selected := make(map[string]bool, len(indices))
+	for _, index := range indices {
+		selected[index] = true
+	}
+	found := 0
+	for _, pair := range global.CHAT_CONFIG.MongoEsSync {
+		if len(selected) > 0 && !selected[pair.EsIndex] {
+			continue
+		}
+		found++
+		newIndex, err := s.Reindex(ctx, pair.MongoCollection, pair.EsIndex, deleteOld)
+		if err != nil {
+			return fmt.Errorf("重建 ES 索引 '%s' 失败: %w", pair.EsIndex, err)
+		}
+		slog.Info(fmt.Sprintf("ES 索引 '%s' 重建完成，当前指向 %s", pair.EsIndex, newIndex))
+	}
+	if found == 0 {
+		return errors.New("没有匹配的 mongo_es_sync 配置")
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"context"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxEmojiLength 单个表情的最大字符数，组合表情(肤色、家庭等)由多个字符组成
+const maxEmojiLength = 16
+
+// ReactionSummary 表情回应统计，Reacted 表示当前用户是否回应了该表情
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// AddReaction 给消息添加表情回应，同一用户对同一表情只计一次，添加后向房间广播 reaction 事件
+func (s *MessageService) AddReaction(userId, messageId, emoji string) ([]ReactionSummary, error) {
+	message, err := s.getReactableMessage(userId, messageId, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	coll := global.CHAT_MONGODB.Collection(userMessagesColl)
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated model.UserMessages
+	// 表情已存在时把用户加入集合
+	addToExisting := func() error {
+		return coll.FindOneAndUpdate(ctx,
+			bson.D{{Key: "_id", Value: message.ID}, {Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}}, {Key: "reactions.emoji", Value: emoji}},
+			bson.D{{Key: "$addToSet", Value: bson.D{{Key: "reactions.$.user_ids", Value: userId}}}},
+			after,
+		).Decode(&updated)
+	}
+
+	err = addToExisting()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// 表情不存在时追加一条记录，条件中限制表情种类上限，并防止并发追加同一个表情
+		filter := bson.D{{Key: "_id", Value: message.ID}, {Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}}, {Key: "reactions.emoji", Value: bson.D{{Key: "$ne", Value: emoji}}}}
+		if limit := global.CHAT_CONFIG.Message.MaxReactions; limit > 0 {
+			filter = append(filter, bson.E{Key: "reactions." + strconv.Itoa(limit-1), Value: bson.D{{Key: "$exists", Value: false}}})
+		}
+		err = coll.FindOneAndUpdate(ctx, filter,
+			bson.D{{Key: "$push", Value: bson.D{{Key: "reactions", Value: model.UserMessageReaction{Emoji: emoji, UserIds: []string{userId}}}}}},
+			after,
+		).Decode(&updated)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// 其他用户刚好追加了同一个表情，或者已达上限
+			err = addToExisting()
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, common.NewServiceError(common.REACTION_LIMIT)
+			}
+		}
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("AddReaction-->添加表情回应失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	broadcastReaction(&updated, userId, emoji, constant.ReactionActionAdd)
+	return summarizeReactions(updated.Reactions, userId), nil
+}
+
+// RemoveReaction 取消自己的表情回应，没有用户的表情会被移除，取消后向房间广播 reaction 事件
+func (s *MessageService) RemoveReaction(userId, messageId, emoji string) ([]ReactionSummary, error) {
+	message, err := s.getReactableMessage(userId, messageId, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	coll := global.CHAT_MONGODB.Collection(userMessagesColl)
+	result, err := coll.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: message.ID}, {Key: "reactions.emoji", Value: emoji}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "reactions.$.user_ids", Value: userId}}}},
+	)
+	if err != nil {
+		global.CHAT_LOG.Error("RemoveReaction-->取消表情回应失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	var updated model.UserMessages
+	err = coll.FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: message.ID}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "reactions", Value: bson.D{{Key: "user_ids", Value: bson.D{{Key: "$size", Value: 0}}}}}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("RemoveReaction-->清理空表情回应失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	// 用户本来就没有回应该表情时不广播
+	if result.ModifiedCount > 0 {
+		broadcastReaction(&updated, userId, emoji, constant.ReactionActionRemove)
+	}
+	return summarizeReactions(updated.Reactions, userId), nil
+}
+
+// getReactableMessage 校验表情并查询可以回应的消息，只有房间成员可以回应未删除的消息
+func (s *MessageService) getReactableMessage(userId, messageId, emoji string) (*model.UserMessages, error) {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	id, err := bson.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	var message model.UserMessages
+	err = global.CHAT_MONGODB.Collection(userMessagesColl).FindOne(context.Background(),
+		bson.D{{Key: "_id", Value: id}},
+		options.FindOne().SetProjection(bson.D{{Key: "room_id", Value: 1}, {Key: "is_deleted", Value: 1}}),
+	).Decode(&message)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("getReactableMessage-->查询消息失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	if message.IsDeleted {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, message.RoomId); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// broadcastReaction 向房间广播表情回应变化，count 为该表情当前的回应人数
+func broadcastReaction(message *model.UserMessages, userId, emoji, action string) {
+	count := 0
+	for _, reaction := range message.Reactions {
+		if reaction.Emoji == emoji {
+			count = len(reaction.UserIds)
+			break
+		}
+	}
+	broadcastRoomEvent(constant.MessageTypeReaction, message.RoomId, userId, map[string]interface{}{
+		"message_id": message.ID.Hex(),
+		"emoji":      emoji,
+		"action":     action,
+		"count":      count,
+	})
+}
+
+// summarizeReactions 把表情回应的用户集合汇总为数量，不向客户端暴露完整的用户列表
+func summarizeReactions(reactions []model.UserMessageReaction, userId string) []ReactionSummary {
+	if len(reactions) == 0 {
+		return nil
+	}
+	summaries := make([]ReactionSummary, 0, len(reactions))
+	for _, reaction := range reactions {
+		if len(reaction.UserIds) == 0 {
+			continue
+		}
+		summary := ReactionSummary{Emoji: reaction.Emoji, Count: len(reaction.UserIds)}
+		for _, id := range reaction.UserIds {
+			if id == userId {
+				summary.Reacted = true
+				break
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"chat-server/model"
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeReactions(t *testing.T) {
+	tests := []struct {
+		name      string
+		reactions []model.UserMessageReaction
+		userId    string
+		want      []ReactionSummary
+	}{
+		{
+			name:      "没有表情回应",
+			reactions: nil,
+			userId:    "u1",
+			want:      nil,
+		},
+		{
+			name: "统计数量并标记自己的回应",
+			reactions: []model.UserMessageReaction{
+				{Emoji: "👍", UserIds: []string{"u1", "u2"}},
+				{Emoji: "🎉", UserIds: []string{"u3"}},
+			},
+			userId: "u1",
+			want: []ReactionSummary{
+				{Emoji: "👍", Count: 2, Reacted: true},
+				{Emoji: "🎉", Count: 1, Reacted: false},
+			},
+		},
+		{
+			name: "没有用户的表情被跳过",
+			reactions: []model.UserMessageReaction{
+				{Emoji: "👍", UserIds: nil},
+				{Emoji: "🎉", UserIds: []string{"u2"}},
+			},
+			userId: "u1",
+			want: []ReactionSummary{
+				{Emoji: "🎉", Count: 1, Reacted: false},
+			},
+		},
+		{
+			name: "全部表情都没有用户",
+			reactions: []model.UserMessageReaction{
+				{Emoji: "👍", UserIds: []string{}},
+			},
+			userId: "u1",
+			want:   []ReactionSummary{},
+		},
+		{
+			name: "保持表情的原有顺序",
+			reactions: []model.UserMessageReaction{
+				{Emoji: "🎉", UserIds: []string{"u2"}},
+				{Emoji: "👍", UserIds: []string{"u1"}},
+			},
+			userId: "u1",
+			want: []ReactionSummary{
+				{Emoji: "🎉", Count: 1, Reacted: false},
+				{Emoji: "👍", Count: 1, Reacted: true},
+			},
+		},
+		{
+			name: "查询者为空时不标记",
+			reactions: []model.UserMessageReaction{
+				{Emoji: "👍", UserIds: []string{"u1"}},
+			},
+			userId: "",
+			want: []ReactionSummary{
+				{Emoji: "👍", Count: 1, Reacted: false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeReactions(tt.reactions, tt.userId); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summarizeReactions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxClientMsgIdLength 客户端幂等键的最大长度
+const maxClientMsgIdLength = 64
+
+// ResyncPage 按序号补发的结果，消息按序号正序排列
+// LatestSeq 为房间当前最新的序号，HasMore 为true时客户端从最后一条消息的序号继续补发
+type ResyncPage struct {
+	RoomId    string           `json:"room_id"`
+	Messages  []HistoryMessage `json:"messages"`
+	HasMore   bool             `json:"has_more"`
+	LatestSeq int64            `json:"latest_seq"`
+}
+
+// ResyncMessages 查询房间内序号在 [fromSeq, toSeq] 之间的消息，toSeq 为0时查询到最新，只有房间成员可以查询
+func (s *MessageService) ResyncMessages(userId, roomId string, fromSeq, toSeq int64) (*ResyncPage, error) {
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, roomId); err != nil {
+		return nil, err
+	}
+	if fromSeq < 1 || (toSeq != 0 && toSeq < fromSeq) {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+
+	ctx := context.Background()
+	seqFilter := bson.D{{Key: "$gte", Value: fromSeq}}
+	if toSeq > 0 {
+		seqFilter = append(seqFilter, bson.E{Key: "$lte", Value: toSeq})
+	}
+	filter := bson.D{{Key: "room_id", Value: roomId}, {Key: "seq", Value: seqFilter}}
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(constant.MaxResyncCount + 1)
+
+	var userMessages []model.UserMessages
+	if err := findAll(ctx, userMessagesColl, filter, opts, &userMessages); err != nil {
+		return nil, err
+	}
+	var systemMessages []model.SystemMessages
+	if err := findAll(ctx, systemMessagesColl, filter, opts, &systemMessages); err != nil {
+		return nil, err
+	}
+	messages := make([]HistoryMessage, 0, len(userMessages)+len(systemMessages))
+	for _, msg := range userMessages {
+		messages = append(messages, newUserHistoryMessage(msg, userId))
+	}
+	for _, msg := range systemMessages {
+		messages = append(messages, HistoryMessage{ID: msg.ID, RoomId: msg.RoomId, SenderId: msg.SenderId, Type: msg.Type, Content: msg.Content, CreatedAt: msg.CreatedAt, Seq: msg.Seq})
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	hasMore := len(messages) > constant.MaxResyncCount
+	if hasMore {
+		messages = messages[:constant.MaxResyncCount]
+	}
+
+	latestSeq, err := global.CHAT_REDIS.Get(ctx, roomSeqKey(roomId)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		global.CHAT_LOG.Warn("ResyncMessages-->读取房间序号失败", "room_id", roomId, "err", err)
+	}
+	return &ResyncPage{RoomId: roomId, Messages: messages, HasMore: hasMore, LatestSeq: latestSeq}, nil
+}
+
+// incrRoomSeqScript 房间序号计数器存在时加一，不存在时返回0，由调用方从已持久化的最大序号初始化
+var incrRoomSeqScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('INCR', KEYS[1])
+end
+return 0
+`)
+
+// nextRoomSeq 分配房间内的下一个序号，Redis 或 MongoDB 不可用时返回错误，消息不投递
+// 计数器不存在(新房间或 Redis 数据被清空)时用已持久化的最大序号初始化，多个节点同时初始化时只有一个生效，不会重复分配
+func nextRoomSeq(ctx context.Context, roomId string) (int64, error) {
+	key := roomSeqKey(roomId)
+	seq, err := incrRoomSeqScript.Run(ctx, global.CHAT_REDIS, []string{key}).Int64()
+	if err != nil {
+		global.CHAT_LOG.Error("nextRoomSeq-->分配房间序号失败", "room_id", roomId, "err", err)
+		return 0, common.NewServiceError(common.ERROR)
+	}
+	if seq > 0 {
+		return seq, nil
+	}
+
+	maxSeq, err := maxPersistedSeq(ctx, roomId)
+	if err != nil {
+		return 0, common.NewServiceError(common.ERROR)
+	}
+	if err := global.CHAT_REDIS.SetNX(ctx, key, maxSeq, 0).Err(); err != nil {
+		global.CHAT_LOG.Error("nextRoomSeq-->初始化房间序号失败", "room_id", roomId, "err", err)
+		return 0, common.NewServiceError(common.ERROR)
+	}
+	if seq, err = global.CHAT_REDIS.Incr(ctx, key).Result(); err != nil {
+		global.CHAT_LOG.Error("nextRoomSeq-->分配房间序号失败", "room_id", roomId, "err", err)
+		return 0, common.NewServiceError(common.ERROR)
+	}
+	return seq, nil
+}
+
+// maxPersistedSeq 查询房间内已持久化消息的最大序号
+func maxPersistedSeq(ctx context.Context, roomId string) (int64, error) {
+	var maxSeq int64
+	for _, collName := range []string{userMessagesColl, systemMessagesColl} {
+		var doc struct {
+			Seq int64 `bson:"seq"`
+		}
+		err := global.CHAT_MONGODB.Collection(collName).FindOne(ctx,
+			bson.D{{Key: "room_id", Value: roomId}, {Key: "seq", Value: bson.D{{Key: "$exists", Value: true}}}},
+			options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}).SetProjection(bson.D{{Key: "seq", Value: 1}}),
+		).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			global.CHAT_LOG.Error("maxPersistedSeq-->查询最大序号失败", "collection", collName, "err", err)
+			return 0, err
+		}
+		if doc.Seq > maxSeq {
+			maxSeq = doc.Seq
+		}
+	}
+	return maxSeq, nil
+}
+
+// claimClientMsgId 登记客户端幂等键并预先分配消息id，返回false表示消息不应广播，返回错误时向客户端回复 error 帧
+// 幂等键已存在时说明是重复发送，直接回传之前的 ack；Redis 不可用时跳过幂等校验
+func (client *Client) claimClientMsgId(wsMessage *WebSocketMessage) (bool, error) {
+	if len(wsMessage.ClientMsgId) > maxClientMsgIdLength {
+		return false, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	ctx := context.Background()
+	messageId := bson.NewObjectID().Hex()
+	key := clientMsgIdKey(client.UserId, wsMessage.ClientMsgId)
+	claimed, err := global.CHAT_REDIS.SetNX(ctx, key, messageId, constant.MessageIdempotencyExpire).Result()
+	if err != nil {
+		global.CHAT_LOG.Warn("ReadPump 登记客户端幂等键失败", "user_id", client.UserId, "err", err)
+		return true, nil
+	}
+	if claimed {
+		wsMessage.ID = messageId
+		return true, nil
+	}
+
+	// 重复发送，值为 消息id 或 消息id:序号(已持久化)
+	value, err := global.CHAT_REDIS.Get(ctx, key).Result()
+	if err != nil {
+		global.CHAT_LOG.Warn("ReadPump 读取客户端幂等键失败", "user_id", client.UserId, "err", err)
+		return false, common.NewServiceError(common.ERROR)
+	}
+	existingId, seqValue, _ := strings.Cut(value, ":")
+	seq, _ := strconv.ParseInt(seqValue, 10, 64)
+	client.Manager.SendToClient(client, newAckMessage(wsMessage, existingId, seq, true))
+	return false, nil
+}
+
+// ackMessage 消息持久化后向发送连接回传 ack，并在幂等键中记录序号，客户端没有传幂等键和请求id时不回传
+func (manager *WebSocketManager) ackMessage(message *WebSocketMessage) {
+	if message.origin == nil || (message.ClientMsgId == "" && message.RequestId == "") {
+		return
+	}
+	if message.ClientMsgId != "" {
+		key := clientMsgIdKey(message.SenderId, message.ClientMsgId)
+		if err := global.CHAT_REDIS.SetXX(context.Background(), key, fmt.Sprintf("%s:%d", message.ID, message.Seq), redis.KeepTTL).Err(); err != nil {
+			global.CHAT_LOG.Warn("ackMessage-->更新客户端幂等键失败", "err", err)
+		}
+	}
+	manager.SendToClient(message.origin, newAckMessage(message, message.ID, message.Seq, false))
+}
+
+// releaseClientMsgId 消息保存失败时删除幂等键
+func releaseClientMsgId(message *WebSocketMessage) {
+	if message.ClientMsgId == "" {
+		return
+	}
+	if err := global.CHAT_REDIS.Del(context.Background(), clientMsgIdKey(message.SenderId, message.ClientMsgId)).Err(); err != nil {
+		global.CHAT_LOG.Warn("releaseClientMsgId-->删除客户端幂等键失败", "err", err)
+	}
+}
+
+// handleResync 处理补发请求，content 中 from_seq 为起始序号，to_seq 为结束序号(可选)
+func (client *Client) handleResync(wsMessage *WebSocketMessage) error {
+	contentMap, ok := wsMessage.Content.(map[string]interface{})
+	if !ok {
+		return common.NewServiceError(common.MESSAGE_INVALID)
+	}
+	page, err := ServiceGroupApp.MessageService.ResyncMessages(client.UserId, wsMessage.RoomId,
+		int64(utils.GetIntValue(contentMap, "from_seq")), int64(utils.GetIntValue(contentMap, "to_seq")))
+	if err != nil {
+		return err
+	}
+	client.Manager.SendToClient(client, &WebSocketMessage{
+		Type:      constant.MessageTypeResync,
+		RoomId:    wsMessage.RoomId,
+		SenderId:  client.UserId,
+		Content:   page,
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+		RequestId: wsMessage.RequestId,
+	})
+	return nil
+}
+
+// newAckMessage 构造用户消息的 ack，带回客户端的请求id和幂等键，duplicate 为true表示重复发送的消息
+func newAckMessage(message *WebSocketMessage, messageId string, seq int64, duplicate bool) *WebSocketMessage {
+	return &WebSocketMessage{
+		Type:      constant.MessageTypeAck,
+		RoomId:    message.RoomId,
+		SenderId:  message.SenderId,
+		RequestId: message.RequestId,
+		Content: map[string]interface{}{
+			"client_msg_id": message.ClientMsgId,
+			"message_id":    messageId,
+			"seq":           seq,
+			"duplicate":     duplicate,
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}
+}
+
+// roomSeqKey 房间序号在 Redis 中的 key
+func roomSeqKey(roomId string) string {
+	return fmt.Sprintf("%s:%s", constant.RoomSeqPrefix, roomId)
+}
+
+// clientMsgIdKey 客户端幂等键在 Redis 中的 key
+func clientMsgIdKey(userId, clientMsgId string) string {
+	return fmt.Sprintf("%s:%s:%s", constant.MessageIdempotencyPrefix, userId, clientMsgId)
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 100
+	userMessagesColl    = "user_messages"
+	systemMessagesColl  = "system_messages"
+)
+
+type MessageService struct{}
+
+// HistoryMessage 历史消息，合并用户消息和系统消息
+type HistoryMessage struct {
+	ID        bson.ObjectID     `json:"_id"`
+	RoomId    string            `json:"room_id"`
+	SenderId  string            `json:"sender_id"`
+	Type      string            `json:"type"`
+	Content   interface{}       `json:"content"`
+	CreatedAt int64             `json:"created_at"`
+	Seq       int64             `json:"seq,omitempty"`
+	EditedAt  int64             `json:"edited_at,omitempty"`
+	IsDeleted bool              `json:"is_deleted,omitempty"`
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
+	// 线程根消息的回复统计
+	ReplyCount  int   `json:"reply_count,omitempty"`
+	LastReplyAt int64 `json:"last_reply_at,omitempty"`
+}
+
+// HistoryPage 历史消息分页结果，消息按时间正序排列
+type HistoryPage struct {
+	Messages []HistoryMessage `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+}
+
+// messageCursor 分页游标，id为空时只按时间比较
+type messageCursor struct {
+	CreatedAt int64
+	ID        *bson.ObjectID
+}
+
+// ListRoomMessages 分页查询房间历史消息，只有房间成员可以查询
+// 不传游标时返回最新的一页；before向更早翻页，after向更新翻页
+func (s *MessageService) ListRoomMessages(userId, roomId, before, after string, limit int64) (*HistoryPage, error) {
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, roomId); err != nil {
+		return nil, err
+	}
+	if before != "" && after != "" {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	limit = clampHistoryLimit(limit)
+
+	ctx := context.Background()
+	filter := bson.D{{Key: "room_id", Value: roomId}}
+	// 向更早翻页时倒序查询，结果再反转为正序
+	descending := after == ""
+	cursorValue := before
+	if !descending {
+		cursorValue = after
+	}
+	if cursorValue != "" {
+		cursor, err := s.parseCursor(ctx, roomId, cursorValue)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, cursorFilter(cursor, descending)...)
+	}
+
+	// 查询条件和排序与 room_timestamp 索引(room_id, created_at, _id)一致
+	order := 1
+	if descending {
+		order = -1
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(limit + 1)
+
+	var userMessages []model.UserMessages
+	if err := findAll(ctx, userMessagesColl, filter, opts, &userMessages); err != nil {
+		return nil, err
+	}
+	var systemMessages []model.SystemMessages
+	if err := findAll(ctx, systemMessagesColl, filter, opts, &systemMessages); err != nil {
+		return nil, err
+	}
+
+	messages := make([]HistoryMessage, 0, len(userMessages)+len(systemMessages))
+	for _, msg := range userMessages {
+		messages = append(messages, newUserHistoryMessage(msg, userId))
+	}
+	for _, msg := range systemMessages {
+		messages = append(messages, HistoryMessage{ID: msg.ID, RoomId: msg.RoomId, SenderId: msg.SenderId, Type: msg.Type, Content: msg.Content, CreatedAt: msg.CreatedAt, Seq: msg.Seq})
+	}
+
+	// 合并两个集合的结果，按查询方向排序后截取一页
+	sort.Slice(messages, func(i, j int) bool {
+		if descending {
+			return messageBefore(messages[j], messages[i])
+		}
+		return messageBefore(messages[i], messages[j])
+	})
+	hasMore := int64(len(messages)) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if descending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	return &HistoryPage{Messages: messages, HasMore: hasMore}, nil
+}
+
+// newUserHistoryMessage 把用户消息转换为历史消息，userId 为查询者，用于标记自己的表情回应
+func newUserHistoryMessage(msg model.UserMessages, userId string) HistoryMessage {
+	return HistoryMessage{
+		ID:          msg.ID,
+		RoomId:      msg.RoomId,
+		SenderId:    msg.SenderId,
+		Type:        msg.Type,
+		Content:     msg.Content,
+		CreatedAt:   msg.CreatedAt,
+		Seq:         msg.Seq,
+		EditedAt:    msg.EditedAt,
+		IsDeleted:   msg.IsDeleted,
+		Reactions:   summarizeReactions(msg.Reactions, userId),
+		ReplyCount:  msg.ReplyCount,
+		LastReplyAt: msg.LastReplyAt,
+	}
+}
+
+// parseCursor 解析游标，消息id需要查询出对应的创建时间
+func (s *MessageService) parseCursor(ctx context.Context, roomId, value string) (*messageCursor, error) {
+	if id, err := bson.ObjectIDFromHex(value); err == nil {
+		for _, collName := range []string{userMessagesColl, systemMessagesColl} {
+			var doc struct {
+				CreatedAt int64 `bson:"created_at"`
+			}
+			err := global.CHAT_MONGODB.Collection(collName).
+				FindOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "room_id", Value: roomId}},
+					options.FindOne().SetProjection(bson.D{{Key: "created_at", Value: 1}})).
+				Decode(&doc)
+			if err == nil {
+				return &messageCursor{CreatedAt: doc.CreatedAt, ID: &id}, nil
+			}
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				global.CHAT_LOG.Error("parseCursor-->查询游标消息失败", "err", err)
+				return nil, common.NewServiceError(common.ERROR)
+			}
+		}
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+
+	createdAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || createdAt < 0 {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	return &messageCursor{CreatedAt: createdAt}, nil
+}
+
+// cursorFilter 根据游标生成查询条件，时间相同时按_id继续比较
+func cursorFilter(cursor *messageCursor, descending bool) bson.D {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	if cursor.ID == nil {
+		return bson.D{{Key: "created_at", Value: bson.D{{Key: op, Value: cursor.CreatedAt}}}}
+	}
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "created_at", Value: bson.D{{Key: op, Value: cursor.CreatedAt}}}},
+		bson.D{{Key: "created_at", Value: cursor.CreatedAt}, {Key: "_id", Value: bson.D{{Key: op, Value: *cursor.ID}}}},
+	}}}
+}
+
+// messageBefore 判断消息a是否早于消息b
+func messageBefore(a, b HistoryMessage) bool {
+	if a.CreatedAt != b.CreatedAt {
+		return a.CreatedAt < b.CreatedAt
+	}
+	return a.ID.Hex() < b.ID.Hex()
+}
+
+// findAll 查询集合并解码全部结果
+func findAll(ctx context.Context, collName string, filter bson.D, opts *options.FindOptionsBuilder, results interface{}) error {
+	cursor, err := global.CHAT_MONGODB.Collection(collName).Find(ctx, filter, opts)
+	if err != nil {
+		global.CHAT_LOG.Error("findAll-->查询MongoDB失败", "collection", collName, "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	if err := cursor.All(ctx, results); err != nil {
+		global.CHAT_LOG.Error("findAll-->解码MongoDB结果失败", "collection", collName, "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	return nil
+}
+
+// EditMessage 编辑自己发送的文本或回复消息，旧内容写入编辑历史，编辑后向房间广播 edit 事件
+func (s *MessageService) EditMessage(userId, messageId, text string) (*model.UserMessages, error) {
+	if text == "" {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	message, err := s.getOwnMessage(userId, messageId, global.CHAT_CONFIG.Message.EditWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	var field string
+	switch message.Type {
+	case constant.MessageTypeText:
+		field = "content.text"
+	case constant.MessageTypeReply:
+		field = "content.reply.text"
+	default:
+		return nil, common.NewServiceError(common.MESSAGE_NOT_EDITABLE)
+	}
+
+	now := utils.GetUTCMillisTimestamp()
+	var updated model.UserMessages
+	// 条件更新，防止并发删除后仍被编辑
+	err = global.CHAT_MONGODB.Collection(userMessagesColl).FindOneAndUpdate(context.Background(),
+		bson.D{{Key: "_id", Value: message.ID}, {Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}}},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: field, Value: text}, {Key: "edited_at", Value: now}}},
+			{Key: "$push", Value: bson.D{{Key: "edit_history", Value: model.UserMessageEdit{Content: message.Content, EditedAt: now}}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("EditMessage-->更新消息失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	broadcastRoomEvent(constant.MessageTypeEdit, updated.RoomId, userId, map[string]interface{}{
+		"message_id": updated.ID.Hex(),
+		"content":    updated.Content,
+		"edited_at":  updated.EditedAt,
+	})
+	return &updated, nil
+}
+
+// DeleteMessage 删除自己发送的消息，内容、编辑历史和表情回应被清空只保留墓碑，删除后向房间广播 delete 事件
+func (s *MessageService) DeleteMessage(userId, messageId string) error {
+	message, err := s.getOwnMessage(userId, messageId, global.CHAT_CONFIG.Message.DeleteWindow)
+	if err != nil {
+		return err
+	}
+
+	now := utils.GetUTCMillisTimestamp()
+	result, err := global.CHAT_MONGODB.Collection(userMessagesColl).UpdateOne(context.Background(),
+		bson.D{{Key: "_id", Value: message.ID}, {Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "content", Value: model.UserMessageContent{}},
+				{Key: "is_deleted", Value: true},
+				{Key: "deleted_at", Value: now},
+			}},
+			{Key: "$unset", Value: bson.D{{Key: "edit_history", Value: ""}, {Key: "reactions", Value: ""}}},
+		},
+	)
+	if err != nil {
+		global.CHAT_LOG.Error("DeleteMessage-->删除消息失败", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	if result.MatchedCount == 0 {
+		return common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+
+	broadcastRoomEvent(constant.MessageTypeDelete, message.RoomId, userId, map[string]interface{}{
+		"message_id": message.ID.Hex(),
+		"deleted_at": now,
+	})
+	return nil
+}
+
+// getOwnMessage 查询用户自己发送的未删除消息，并校验仍是房间成员且没有超过时间窗口(秒，0为不限制)
+func (s *MessageService) getOwnMessage(userId, messageId string, window int) (*model.UserMessages, error) {
+	id, err := bson.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	var message model.UserMessages
+	err = global.CHAT_MONGODB.Collection(userMessagesColl).FindOne(context.Background(), bson.D{{Key: "_id", Value: id}}).Decode(&message)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("getOwnMessage-->查询消息失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	if message.IsDeleted {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if message.SenderId != userId {
+		return nil, common.NewServiceError(common.ROOM_PERMISSION_DENIED)
+	}
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, message.RoomId); err != nil {
+		return nil, err
+	}
+	if window > 0 && utils.GetUTCMillisTimestamp()-message.CreatedAt > int64(window)*1000 {
+		return nil, common.NewServiceError(common.MESSAGE_EDIT_EXPIRED)
+	}
+	return &message, nil
+}
+
+// broadcastRoomEvent 向房间广播不需要持久化的事件(编辑、删除等)
+func broadcastRoomEvent(eventType, roomId, senderId string, content interface{}) {
+	manager, ok := global.CHAT_WEBSOCKET_MANAGER.(*WebSocketManager)
+	if !ok {
+		return
+	}
+	// 事件不分配序号，广播不会失败
+	_ = manager.BroadcastToRoom(roomId, &WebSocketMessage{
+		Type:      eventType,
+		RoomId:    roomId,
+		SenderId:  senderId,
+		Content:   content,
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	})
+}
+
+// clampHistoryLimit 分页数量不传时使用默认值，超过上限时按上限查询
+func clampHistoryLimit(limit int64) int64 {
+	if limit <= 0 {
+		return defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		return maxHistoryLimit
+	}
+	return limit
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCursorFilter(t *testing.T) {
+	id := bson.NewObjectID()
+	tests := []struct {
+		name       string
+		cursor     messageCursor
+		descending bool
+		want       bson.D
+	}{
+		{
+			name:       "时间戳游标向更早翻页",
+			cursor:     messageCursor{CreatedAt: 1000},
+			descending: true,
+			want:       bson.D{{Key: "created_at", Value: bson.D{{Key: "$lt", Value: int64(1000)}}}},
+		},
+		{
+			name:       "时间戳游标向更新翻页",
+			cursor:     messageCursor{CreatedAt: 1000},
+			descending: false,
+			want:       bson.D{{Key: "created_at", Value: bson.D{{Key: "$gt", Value: int64(1000)}}}},
+		},
+		{
+			name:       "消息id游标向更早翻页，时间相同时比较_id",
+			cursor:     messageCursor{CreatedAt: 1000, ID: &id},
+			descending: true,
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "created_at", Value: bson.D{{Key: "$lt", Value: int64(1000)}}}},
+				bson.D{{Key: "created_at", Value: int64(1000)}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}}},
+			}}},
+		},
+		{
+			name:       "消息id游标向更新翻页，时间相同时比较_id",
+			cursor:     messageCursor{CreatedAt: 1000, ID: &id},
+			descending: false,
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "created_at", Value: bson.D{{Key: "$gt", Value: int64(1000)}}}},
+				bson.D{{Key: "created_at", Value: int64(1000)}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: id}}}},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cursorFilter(&tt.cursor, tt.descending); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cursorFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageBefore(t *testing.T) {
+	earlierId := bson.NewObjectID()
+	laterId := bson.NewObjectID()
+	tests := []struct {
+		name string
+		a, b HistoryMessage
+		want bool
+	}{
+		{
+			name: "时间早的在前",
+			a:    HistoryMessage{ID: laterId, CreatedAt: 1000},
+			b:    HistoryMessage{ID: earlierId, CreatedAt: 2000},
+			want: true,
+		},
+		{
+			name: "时间晚的在后",
+			a:    HistoryMessage{ID: earlierId, CreatedAt: 2000},
+			b:    HistoryMessage{ID: laterId, CreatedAt: 1000},
+			want: false,
+		},
+		{
+			name: "时间相同时按_id比较",
+			a:    HistoryMessage{ID: earlierId, CreatedAt: 1000},
+			b:    HistoryMessage{ID: laterId, CreatedAt: 1000},
+			want: true,
+		},
+		{
+			name: "同一条消息不早于自己",
+			a:    HistoryMessage{ID: earlierId, CreatedAt: 1000},
+			b:    HistoryMessage{ID: earlierId, CreatedAt: 1000},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageBefore(tt.a, tt.b); got != tt.want {
+				t.Errorf("messageBefore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampHistoryLimit(t *testing.T) {
+	tests := []struct {
+		limit int64
+		want  int64
+	}{
+		{limit: -1, want: defaultHistoryLimit},
+		{limit: 0, want: defaultHistoryLimit},
+		{limit: 1, want: 1},
+		{limit: maxHistoryLimit, want: maxHistoryLimit},
+		{limit: maxHistoryLimit + 1, want: maxHistoryLimit},
+	}
+	for _, tt := range tests {
+		if got := clampHistoryLimit(tt.limit); got != tt.want {
+			t.Errorf("clampHistoryLimit(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ThreadPage 线程分页结果，Parent 为线程的根消息，回复按时间正序排列
+type ThreadPage struct {
+	Parent   HistoryMessage   `json:"parent"`
+	Messages []HistoryMessage `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+}
+
+// ResolveThreadParent 校验回复的消息在同一房间且未删除，返回线程根消息的id
+// 回复的是线程中的回复时，挂到该线程的根消息上，线程只有一层
+func (s *MessageService) ResolveThreadParent(roomId, replyTo string) (string, error) {
+	parent, err := findRoomMessage(context.Background(), roomId, replyTo)
+	if err != nil {
+		return "", err
+	}
+	if parent.Type == constant.MessageTypeReply && parent.Content.Reply != nil {
+		return parent.Content.Reply.ReplyTo, nil
+	}
+	return parent.ID.Hex(), nil
+}
+
+// ListThreadMessages 分页查询线程的回复，只有房间成员可以查询
+// 不传游标时返回最早的一页；before向更早翻页，after向更新翻页
+func (s *MessageService) ListThreadMessages(userId, messageId, before, after string, limit int64) (*ThreadPage, error) {
+	if before != "" && after != "" {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	limit = clampHistoryLimit(limit)
+	id, err := bson.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+
+	ctx := context.Background()
+	var parent model.UserMessages
+	err = global.CHAT_MONGODB.Collection(userMessagesColl).FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&parent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("ListThreadMessages-->查询线程根消息失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, parent.RoomId); err != nil {
+		return nil, err
+	}
+
+	// 线程是对话视图，默认从最早的回复开始，只有 before 时倒序查询
+	descending := before != ""
+	filter := bson.D{{Key: "content.reply.reply_to", Value: parent.ID.Hex()}, {Key: "room_id", Value: parent.RoomId}}
+	if cursorValue := before + after; cursorValue != "" {
+		cursor, err := s.parseCursor(ctx, parent.RoomId, cursorValue)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, cursorFilter(cursor, descending)...)
+	}
+	order := 1
+	if descending {
+		order = -1
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(limit + 1)
+
+	var replies []model.UserMessages
+	if err := findAll(ctx, userMessagesColl, filter, opts, &replies); err != nil {
+		return nil, err
+	}
+	hasMore := int64(len(replies)) > limit
+	if hasMore {
+		replies = replies[:limit]
+	}
+	if descending {
+		for i, j := 0, len(replies)-1; i < j; i, j = i+1, j-1 {
+			replies[i], replies[j] = replies[j], replies[i]
+		}
+	}
+
+	messages := make([]HistoryMessage, 0, len(replies))
+	for _, msg := range replies {
+		messages = append(messages, newUserHistoryMessage(msg, userId))
+	}
+	return &ThreadPage{Parent: newUserHistoryMessage(parent, userId), Messages: messages, HasMore: hasMore}, nil
+}
+
+// FollowThread 关注或取消关注线程，关注后线程有新回复时收到 thread 通知
+func (s *MessageService) FollowThread(userId, messageId string, follow bool) error {
+	id, err := bson.ObjectIDFromHex(messageId)
+	if err != nil {
+		return common.NewServiceError(common.INVALID_PARAMS)
+	}
+	ctx := context.Background()
+	var parent model.UserMessages
+	err = global.CHAT_MONGODB.Collection(userMessagesColl).FindOne(ctx, bson.D{{Key: "_id", Value: id}},
+		options.FindOne().SetProjection(bson.D{{Key: "room_id", Value: 1}, {Key: "type", Value: 1}, {Key: "is_deleted", Value: 1}}),
+	).Decode(&parent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("FollowThread-->查询线程根消息失败", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	// 只能关注线程的根消息
+	if parent.IsDeleted || parent.Type == constant.MessageTypeReply {
+		return common.NewServiceError(common.MESSAGE_NOT_FOUND)
+	}
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, parent.RoomId); err != nil {
+		return err
+	}
+
+	op := "$addToSet"
+	if !follow {
+		op = "$pull"
+	}
+	if _, err := global.CHAT_MONGODB.Collection(userMessagesColl).UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{{Key: op, Value: bson.D{{Key: "thread_followers", Value: userId}}}},
+	); err != nil {
+		global.CHAT_LOG.Error("FollowThread-->更新线程关注者失败", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	return nil
+}
+
+// onThreadReply 回复保存后更新根消息的回复数和最后回复时间，并通知仍是房间成员的线程关注者
+// 回复者自动关注线程，根消息的发送者在第一条回复时自动关注
+func (s *MessageService) onThreadReply(reply *model.UserMessages) {
+	if reply.Content.Reply == nil {
+		return
+	}
+	parentId, err := bson.ObjectIDFromHex(reply.Content.Reply.ReplyTo)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	coll := global.CHAT_MONGODB.Collection(userMessagesColl)
+	var parent model.UserMessages
+	err = coll.FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: parentId}, {Key: "room_id", Value: reply.RoomId}, {Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "reply_count", Value: 1}}},
+			{Key: "$max", Value: bson.D{{Key: "last_reply_at", Value: reply.CreatedAt}}},
+			{Key: "$addToSet", Value: bson.D{{Key: "thread_followers", Value: reply.SenderId}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&parent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// 根消息已被删除，不再更新线程也不通知关注者
+		global.CHAT_LOG.Warn("onThreadReply-->线程根消息不存在或已删除", "parent_id", reply.Content.Reply.ReplyTo)
+		return
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("onThreadReply-->更新线程根消息失败", "parent_id", reply.Content.Reply.ReplyTo, "err", err)
+		return
+	}
+	followers := parent.ThreadFollowers
+	if parent.ReplyCount == 1 && parent.SenderId != reply.SenderId {
+		if _, err := coll.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: parentId}},
+			bson.D{{Key: "$addToSet", Value: bson.D{{Key: "thread_followers", Value: parent.SenderId}}}},
+		); err != nil {
+			global.CHAT_LOG.Error("onThreadReply-->添加线程关注者失败", "err", err)
+		}
+		followers = append(followers, parent.SenderId)
+	}
+
+	// 回复者自己不需要通知
+	recipients := make([]string, 0, len(followers))
+	for _, follower := range followers {
+		if follower != reply.SenderId {
+			recipients = append(recipients, follower)
+		}
+	}
+	// 已退出或被移出房间的关注者不再通知
+	recipients, err = ServiceGroupApp.RoomService.filterRoomMembers(reply.RoomId, recipients)
+	if err != nil || len(recipients) == 0 {
+		return
+	}
+	manager, ok := global.CHAT_WEBSOCKET_MANAGER.(*WebSocketManager)
+	if !ok {
+		return
+	}
+	manager.SendToUsers(&WebSocketMessage{
+		Type:     constant.MessageTypeThread,
+		RoomId:   reply.RoomId,
+		SenderId: reply.SenderId,
+		Content: map[string]interface{}{
+			"parent_id":     parent.ID.Hex(),
+			"message_id":    reply.ID.Hex(),
+			"text":          reply.Content.Reply.Text,
+			"reply_count":   parent.ReplyCount,
+			"last_reply_at": parent.LastReplyAt,
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}, recipients...)
+}
+
+// findRoomMessage 查询房间内未删除的用户消息
+func findRoomMessage(ctx context.Context, roomId, messageId string) (*model.UserMessages, error) {
+	id, err := bson.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, common.NewServiceError(common.REPLY_PARENT_INVALID)
+	}
+	var message model.UserMessages
+	err = global.CHAT_MONGODB.Collection(userMessagesColl).FindOne(ctx,
+		bson.D{{Key: "_id", Value: id}, {Key: "room_id", Value: roomId}, {Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}}},
+		options.FindOne().SetProjection(bson.D{{Key: "type", Value: 1}, {Key: "content.reply", Value: 1}}),
+	).Decode(&message)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.NewServiceError(common.REPLY_PARENT_INVALID)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("findRoomMessage-->查询消息失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return &message, nil
+}
@@ -1,170 +1,320 @@
 package service
 
 import (
+	"chat-server/constant"
 	"chat-server/global"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
-	"log/slog"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
 
-	"strings"
+const (
+	// Change Stream 恢复令牌失效相关的错误码
+	errCodeInvalidResumeToken      = 260
+	errCodeChangeStreamFatal       = 280
+	errCodeChangeStreamHistoryLost = 286
+
+	// 全量对账时扫描ES文档的批大小和 scroll 保持时间
+	reconcileBatchSize = 1000
+	reconcileScrollTTL = time.Minute
 )
 
 type MongoToEsSync struct{}
 
+// changeEvent Change Stream 事件中用到的部分
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	FullDocument  bson.M `bson:"fullDocument"`
+	DocumentKey   bson.M `bson:"documentKey"`
+}
+
+// StartMongoToEsSync 监听集合变更并同步到ES，每成功同步一个事件就持久化恢复令牌
+// 重启后从恢复令牌继续；没有令牌或令牌已从 oplog 过期时，先全量对账再继续监听
 func (s *MongoToEsSync) StartMongoToEsSync(ctx context.Context, collectionName string, esIndex string) error {
 	slog.Info(fmt.Sprintf("初始化 Mongo-Es 数据同步流程 (Collection: %s, Index: %s)", collectionName, esIndex))
+	for {
+		err := s.watchAndSync(ctx, collectionName, esIndex)
+		if !isResumeTokenLost(err) {
+			return err
+		}
+		slog.Warn(fmt.Sprintf("Change Stream 恢复令牌已失效，清除令牌后执行全量对账 (Collection: %s, Index: %s)", collectionName, esIndex), "err", err)
+		if err := global.CHAT_REDIS.Del(ctx, resumeTokenKey(collectionName, esIndex)).Err(); err != nil {
+			return fmt.Errorf("清除 Change Stream 恢复令牌 (Collection: %s) 失败: %w", collectionName, err)
+		}
+	}
+}
+
+// watchAndSync 打开 Change Stream 并逐个处理事件，直到 Context 取消或监听出错
+func (s *MongoToEsSync) watchAndSync(ctx context.Context, collectionName string, esIndex string) error {
 	collection := global.CHAT_MONGODB.Collection(collectionName)
 	pipeline := mongo.Pipeline{}
+	tokenKey := resumeTokenKey(collectionName, esIndex)
+
+	resumeToken, err := loadResumeToken(ctx, tokenKey)
+	if err != nil {
+		return fmt.Errorf("读取 Change Stream 恢复令牌 (Collection: %s) 失败: %w", collectionName, err)
+	}
+	// update 事件默认不带 fullDocument，需要查询出完整文档
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+		slog.Info(fmt.Sprintf("从恢复令牌继续监听 MongoDB 集合 %s", collectionName))
+	}
 
 	//启动监听
-	watch, err := collection.Watch(ctx, pipeline)
+	watch, err := collection.Watch(ctx, pipeline, opts)
 	if err != nil {
 		slog.Error("监听 Change Stream 失败: ", "err", err)
 		return err
 	}
 	defer func() {
-		if err := watch.Close(ctx); err != nil {
+		if err := watch.Close(context.Background()); err != nil {
 			slog.Error(fmt.Sprintf("关闭 MongoDB Change Stream (Collection: %s) 失败:", collectionName), "err", err)
 		} else {
 			slog.Info(fmt.Sprintf("关闭 MongoDB Change Stream (Collection: %s) 成功。", collectionName))
 		}
 	}()
-	slog.Info(fmt.Sprintf("开始监听 MongoDB 集合 %s 变更并同步到 ES 索引 %s...", collectionName, esIndex))
 
-	//开始监听
-	for watch.Next(ctx) {
-		//解码文档 bson.M
-		var event bson.M
-		if err := watch.Decode(&event); err != nil {
-			slog.Error(fmt.Sprintf("解码 Change Stream 事件失败 (Collection: %s):", collectionName), "err", err)
-			continue
+	// 没有恢复令牌时先打开监听再对账，对账期间发生的变更会在之后的事件中重放，写入ES是幂等的
+	if resumeToken == nil {
+		if err := s.reconcile(ctx, collectionName, esIndex); err != nil {
+			return err
 		}
-		operationType, ok := event["operationType"].(string)
-		if !ok {
-			slog.Error(fmt.Sprintf("无法获取 operationType 或其类型不是 string (Collection: %s)", collectionName), "event", event)
-			continue
+		if token := watch.ResumeToken(); token != nil {
+			saveResumeToken(ctx, tokenKey, token)
 		}
-		operationType = strings.TrimSpace(operationType)
-
-		switch operationType {
-		case "insert", "replace", "update":
-			//获取文档
-			document, ok := event["fullDocument"].(bson.M)
-			if !ok {
-				// 1. 将 fullDocument (bson.D) 编码回 BSON 字节
-				docBytes, err := bson.Marshal(event["fullDocument"])
-				if err != nil {
-					slog.Error(fmt.Sprintf("fullDocument 编码为 BSON 字节失败 (Collection: %s):", collectionName), "err", err, "fullDocument_type", fmt.Sprintf("%T", event["fullDocument"]))
-					continue
-				}
-
-				// 2. 将 BSON 字节解码到 bson.M
-				var docMap bson.M
-				err = bson.Unmarshal(docBytes, &docMap)
-				if err != nil {
-					slog.Error(fmt.Sprintf("BSON 字节解码为 bson.M 失败 (Collection: %s):", collectionName), "err", err)
-					continue
-				}
-				document = docMap
-			}
+	}
+	slog.Info(fmt.Sprintf("开始监听 MongoDB 集合 %s 变更并同步到 ES 索引 %s...", collectionName, esIndex))
 
-			//先获取id，再把文档里的_id删掉，不然写入es的时候就会多一个_id
-			var id string
-			if mongoID, ok := document["_id"].(bson.ObjectID); ok {
-				id = mongoID.Hex() // 使用 Hex() 方法获取十六进制字符串
-			} else {
-				id = fmt.Sprintf("%v", document["_id"])
-				slog.Warn(fmt.Sprintf("警告: 文档 _id 类型不是 bson.ObjectID,使用通用字符串格式化 (Collection: %s):", collectionName), "id", id)
-			}
-			delete(document, "_id")
+	// 事件先进入缓冲区，批量写入ES后再记录恢复令牌，重启时从这里继续
+	buffer := newBulkBuffer(collectionName, esIndex)
+	flush := func(flushCtx context.Context) {
+		buffer.Flush(flushCtx)
+		saveResumeToken(flushCtx, tokenKey, watch.ResumeToken())
+	}
+	defer func() {
+		// 退出前写入剩余事件，不受已取消的 Context 影响
+		flush(context.WithoutCancel(ctx))
+	}()
 
-			//把文档转换为json，为了写入es
-			jsonDocument, err := json.Marshal(document)
-			if err != nil {
-				slog.Error(fmt.Sprintf("document 到 JSON 失败 (Collection: %s):", collectionName), "err", err)
-				continue
-			}
-			if len(jsonDocument) == 0 {
-				slog.Error(fmt.Sprintf("JSON 结果为空，跳过写入ES (Collection: %s)。原始 document:", collectionName), "document", document)
+	//开始监听，TryNext 没有新事件时也会返回，保证按时间阈值刷新
+	for {
+		if watch.TryNext(ctx) {
+			var event changeEvent
+			if err := watch.Decode(&event); err != nil {
+				slog.Error(fmt.Sprintf("解码 Change Stream 事件失败 (Collection: %s):", collectionName), "err", err)
 				continue
 			}
+			s.bufferEvent(buffer, collectionName, event)
+		} else if watch.Err() != nil || ctx.Err() != nil {
+			break
+		}
+		if buffer.ShouldFlush() {
+			flush(ctx)
+		}
+	}
 
-			//写入es
-			res, err := global.CHAT_ES.Index(
-				esIndex,
-				strings.NewReader(string(jsonDocument)),
-				global.CHAT_ES.Index.WithDocumentID(id),
-				global.CHAT_ES.Index.WithContext(ctx),
-			)
-			if err != nil {
-				slog.Error(fmt.Sprintf("写入 ES 索引 %s 失败 (Collection: %s):", esIndex, collectionName), "err", err)
-			} else {
-				if res.IsError() {
-					slog.Error(fmt.Sprintf("ES 索引 %s 文档失败 (Collection: %s):", esIndex, collectionName), "文档", res.Status(), "文档ID:", id, "响应:", res.String())
-				} else {
-					slog.Info(fmt.Sprintf("ES 索引 %s 文档同步成功 (Collection: %s):", esIndex, collectionName), "文档", res.Status(), "文档ID:", id)
-				}
-
-				if closeErr := res.Body.Close(); closeErr != nil {
-					slog.Error(fmt.Sprintf("关闭 ES Index 响应体失败 (Collection: %s, ID: %s):", collectionName, id), "err", closeErr)
-				}
-			}
+	if err := watch.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("change Stream 监听 (Collection: %s) 意外终止: %w", collectionName, err)
+	}
+	slog.Info(fmt.Sprintf("MongoDB Change Stream (Collection: %s) 监听结束。", collectionName))
+	return ctx.Err()
+}
 
-		case "delete":
-			//解码获取文档
-			documentKey, ok := event["documentKey"].(bson.M)
-			if !ok {
-				// 1. 将 documentKey (bson.D) 编码回 BSON 字节
-				docBytes, err := bson.Marshal(event["documentKey"])
-				if err != nil {
-					slog.Error(fmt.Sprintf("documentKey 编码为 BSON 字节失败 (Collection: %s):", collectionName), "err", err, "fullDocument_type", fmt.Sprintf("%T", event["fullDocument"]))
-					continue
-				}
-
-				// 2. 将 BSON 字节解码到 bson.M
-				var docMap bson.M
-				err = bson.Unmarshal(docBytes, &docMap)
-				if err != nil {
-					slog.Error(fmt.Sprintf("BSON 字节解码为 bson.M 失败 (Collection: %s):", collectionName), "err", err)
-					continue
-				}
-				documentKey = docMap
-			}
-			//获取16进制id
-			var id string
-			if mongoID, ok := documentKey["_id"].(bson.ObjectID); ok {
-				id = mongoID.Hex() // 使用 Hex() 方法获取十六进制字符串
-			} else {
-				id = fmt.Sprintf("%v", documentKey["_id"])
-				slog.Warn(fmt.Sprintf("警告: 文档 _id 类型不是 bson.ObjectID,使用通用字符串格式化 (Collection: %s):", collectionName), "id", id)
-			}
-			//删除文档
-			res, err := global.CHAT_ES.Delete(esIndex, id, global.CHAT_ES.Delete.WithContext(ctx))
-			if err != nil {
-				slog.Error(fmt.Sprintf("删除 ES 索引 %s 文档失败 (Collection: %s):", esIndex, collectionName), "err", err)
-			} else {
-				if res.IsError() {
-					slog.Error(fmt.Sprintf("ES 索引 %s 删除文档失败 (Collection: %s):", esIndex, collectionName), "文档", res.Status(), "文档ID:", id, "响应:", res.String())
-				} else {
-					slog.Info(fmt.Sprintf("ES 索引 %s 文档同步成功 (删除) (Collection: %s):", esIndex, collectionName), "文档", res.Status(), "文档ID:", id)
-				}
-				if closeErr := res.Body.Close(); closeErr != nil {
-					slog.Error(fmt.Sprintf("关闭 ES Delete 响应体失败 (Collection: %s, ID: %s):", collectionName, id), "err", closeErr)
-				}
-			}
+// bufferEvent 把 Change Stream 事件转换为ES操作放入缓冲区
+func (s *MongoToEsSync) bufferEvent(buffer *bulkBuffer, collectionName string, event changeEvent) {
+	switch strings.TrimSpace(event.OperationType) {
+	case "insert", "replace", "update":
+		// 文档在查询完整文档前已被删除，等待后续的 delete 事件
+		if event.FullDocument == nil {
+			slog.Warn(fmt.Sprintf("事件缺少 fullDocument，跳过 (Collection: %s)", collectionName), "documentKey", event.DocumentKey)
+			return
+		}
+		action, err := newIndexAction(collectionName, event.FullDocument)
+		if err != nil {
+			slog.Error(fmt.Sprintf("转换 ES 文档失败 (Collection: %s):", collectionName), "err", err)
+			return
+		}
+		buffer.Add(action)
 
-		default:
-			slog.Error(fmt.Sprintf("未匹配到任何支持的操作类型 (Collection: %s):", collectionName), "operationType", operationType, "event", event)
+	case "delete":
+		buffer.Add(bulkAction{Action: bulkActionDelete, ID: documentID(collectionName, event.DocumentKey["_id"])})
+
+	default:
+		slog.Error(fmt.Sprintf("未匹配到任何支持的操作类型 (Collection: %s):", collectionName), "operationType", event.OperationType)
+	}
+}
+
+// reconcile 全量对账：把集合中的所有文档写入ES，再删除ES中已不存在于集合的文档
+func (s *MongoToEsSync) reconcile(ctx context.Context, collectionName string, esIndex string) error {
+	slog.Info(fmt.Sprintf("开始全量对账 (Collection: %s, Index: %s)", collectionName, esIndex))
+	cursor, err := global.CHAT_MONGODB.Collection(collectionName).Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("全量对账查询集合 %s 失败: %w", collectionName, err)
+	}
+	defer cursor.Close(context.Background())
+
+	mongoIds := make(map[string]struct{})
+	buffer := newBulkBuffer(collectionName, esIndex)
+	for cursor.Next(ctx) {
+		var document bson.M
+		if err := cursor.Decode(&document); err != nil {
+			slog.Error(fmt.Sprintf("全量对账解码文档失败 (Collection: %s):", collectionName), "err", err)
+			continue
+		}
+		action, err := newIndexAction(collectionName, document)
+		if err != nil {
+			slog.Error(fmt.Sprintf("全量对账转换 ES 文档失败 (Collection: %s):", collectionName), "err", err)
+			continue
+		}
+		mongoIds[action.ID] = struct{}{}
+		buffer.Add(action)
+		if buffer.ShouldFlush() {
+			buffer.Flush(ctx)
 		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("全量对账遍历集合 %s 失败: %w", collectionName, err)
+	}
 
-		if watch.Err() != nil && !errors.Is(watch.Err(), context.Canceled) {
-			return fmt.Errorf("change Stream 监听 (Collection: %s) 意外终止: %w", collectionName, watch.Err())
+	esIds, err := listIndexDocumentIDs(ctx, esIndex)
+	if err != nil {
+		return fmt.Errorf("全量对账读取 ES 索引 %s 文档失败: %w", esIndex, err)
+	}
+	deleted := 0
+	for _, id := range esIds {
+		if _, ok := mongoIds[id]; ok {
+			continue
+		}
+		buffer.Add(bulkAction{Action: bulkActionDelete, ID: id})
+		deleted++
+		if buffer.ShouldFlush() {
+			buffer.Flush(ctx)
 		}
 	}
-	slog.Info(fmt.Sprintf("MongoDB Change Stream (Collection: %s) 监听结束。", collectionName))
+	buffer.Flush(ctx)
+	slog.Info(fmt.Sprintf("全量对账完成 (Collection: %s, Index: %s)", collectionName, esIndex), "indexed", len(mongoIds), "deleted", deleted)
 	return nil
 }
+
+// listIndexDocumentIDs 使用 scroll 遍历ES索引中所有文档的id
+func listIndexDocumentIDs(ctx context.Context, esIndex string) ([]string, error) {
+	body := fmt.Sprintf(`{"size": %d, "_source": false, "sort": ["_doc"]}`, reconcileBatchSize)
+	res, err := global.CHAT_ES.Search(
+		global.CHAT_ES.Search.WithContext(ctx),
+		global.CHAT_ES.Search.WithIndex(esIndex),
+		global.CHAT_ES.Search.WithBody(strings.NewReader(body)),
+		global.CHAT_ES.Search.WithScroll(reconcileScrollTTL),
+	)
+
+	var ids []string
+	var scrollId string
+	defer func() {
+		if scrollId == "" {
+			return
+		}
+		clearRes, err := global.CHAT_ES.ClearScroll(global.CHAT_ES.ClearScroll.WithScrollID(scrollId))
+		if err != nil {
+			slog.Warn("清除 ES scroll 失败", "err", err)
+			return
+		}
+		clearRes.Body.Close()
+	}()
+
+	for {
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			ScrollID string `json:"_scroll_id"`
+			Hits     struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if res.IsError() {
+			res.Body.Close()
+			return nil, fmt.Errorf("ES scroll 查询失败: %s", res.String())
+		}
+		decodeErr := json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		scrollId = page.ScrollID
+		if len(page.Hits.Hits) == 0 {
+			return ids, nil
+		}
+		for _, hit := range page.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		res, err = global.CHAT_ES.Scroll(
+			global.CHAT_ES.Scroll.WithContext(ctx),
+			global.CHAT_ES.Scroll.WithScrollID(scrollId),
+			global.CHAT_ES.Scroll.WithScroll(reconcileScrollTTL),
+		)
+	}
+}
+
+// documentID 把 Mongo 的 _id 转换为ES文档id
+func documentID(collectionName string, mongoId interface{}) string {
+	if id, ok := mongoId.(bson.ObjectID); ok {
+		return id.Hex() // 使用 Hex() 方法获取十六进制字符串
+	}
+	id := fmt.Sprintf("%v", mongoId)
+	slog.Warn(fmt.Sprintf("警告: 文档 _id 类型不是 bson.ObjectID,使用通用字符串格式化 (Collection: %s):", collectionName), "id", id)
+	return id
+}
+
+// resumeTokenKey 恢复令牌在 Redis 中的 key
+func resumeTokenKey(collectionName string, esIndex string) string {
+	return fmt.Sprintf("%s:%s:%s", constant.MongoEsResumeTokenPrefix, collectionName, esIndex)
+}
+
+// loadResumeToken 读取恢复令牌，不存在时返回nil
+func loadResumeToken(ctx context.Context, key string) (bson.Raw, error) {
+	value, err := global.CHAT_REDIS.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token := bson.Raw(value)
+	if err := token.Validate(); err != nil {
+		slog.Warn("Change Stream 恢复令牌格式错误，忽略", "key", key, "err", err)
+		return nil, nil
+	}
+	return token, nil
+}
+
+// saveResumeToken 保存恢复令牌，失败只记录日志，最坏情况是重启后重放部分事件
+func saveResumeToken(ctx context.Context, key string, token bson.Raw) {
+	if token == nil {
+		return
+	}
+	if err := global.CHAT_REDIS.Set(ctx, key, []byte(token), 0).Err(); err != nil {
+		slog.Error("保存 Change Stream 恢复令牌失败", "key", key, "err", err)
+	}
+}
+
+// isResumeTokenLost 判断错误是否由恢复令牌失效(已从 oplog 过期或无效)引起
+func isResumeTokenLost(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	return serverErr.HasErrorCode(errCodeChangeStreamHistoryLost) ||
+		serverErr.HasErrorCode(errCodeInvalidResumeToken) ||
+		serverErr.HasErrorCode(errCodeChangeStreamFatal)
+}
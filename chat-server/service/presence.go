@@ -0,0 +1,252 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type PresenceService struct{}
+
+// RoomPresence 房间内在线的用户
+type RoomPresence struct {
+	RoomId  string   `json:"room_id"`
+	UserIds []string `json:"user_ids"`
+}
+
+// UserPresence 用户的全局在线状态，离线时 LastSeenAt 为最后在线时间
+type UserPresence struct {
+	UserId     string `json:"user_id"`
+	Online     bool   `json:"online"`
+	LastSeenAt int64  `json:"last_seen_at,omitempty"`
+}
+
+// leavePresenceScript 移除连接在房间内的在线状态，用户在房间内没有存活的连接时从房间在线集合中移除
+// 返回1表示用户在房间内离线，房间在线集合中的用户已被清理时不重复离线
+var leavePresenceScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+if redis.call('ZCOUNT', KEYS[1], '(' .. ARGV[3], '+inf') == 0 then
+	return redis.call('ZREM', KEYS[2], ARGV[2])
+end
+return 0
+`)
+
+// sweepPresenceScript 用户在房间内的在线状态已过期时移除，清理和心跳并发时不会误删刚刷新的用户
+var sweepPresenceScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[2])
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// ListRoomOnline 查询房间内在线的用户，只有房间成员可以查询
+func (s *PresenceService) ListRoomOnline(userId, roomId string) (*RoomPresence, error) {
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, roomId); err != nil {
+		return nil, err
+	}
+	now := utils.GetUTCMillisTimestamp()
+	userIds, err := global.CHAT_REDIS.ZRangeByScore(context.Background(), presenceRoomKey(roomId), &redis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", now),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		global.CHAT_LOG.Error("ListRoomOnline-->查询房间在线用户失败", "room_id", roomId, "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return &RoomPresence{RoomId: roomId, UserIds: userIds}, nil
+}
+
+// GetUsersPresence 批量查询用户的全局在线状态，用户在任意房间有存活的连接即为在线
+func (s *PresenceService) GetUsersPresence(userIds []string) ([]UserPresence, error) {
+	if len(userIds) == 0 || len(userIds) > constant.MaxPresenceQueryCount {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	ctx := context.Background()
+	now := utils.GetUTCMillisTimestamp()
+	pipeline := global.CHAT_REDIS.Pipeline()
+	countCmds := make([]*redis.IntCmd, 0, len(userIds))
+	for _, userId := range userIds {
+		countCmds = append(countCmds, pipeline.ZCount(ctx, presenceUserKey(userId), fmt.Sprintf("(%d", now), "+inf"))
+	}
+	lastSeenCmd := pipeline.HMGet(ctx, constant.PresenceLastSeenKey, userIds...)
+	if _, err := pipeline.Exec(ctx); err != nil {
+		global.CHAT_LOG.Error("GetUsersPresence-->查询用户在线状态失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	lastSeen := lastSeenCmd.Val()
+	result := make([]UserPresence, 0, len(userIds))
+	for i, userId := range userIds {
+		presence := UserPresence{UserId: userId, Online: countCmds[i].Val() > 0}
+		if !presence.Online {
+			value, _ := lastSeen[i].(string)
+			presence.LastSeenAt, _ = strconv.ParseInt(value, 10, 64)
+		}
+		result = append(result, presence)
+	}
+	return result, nil
+}
+
+// refreshPresence 登记或刷新连接和订阅房间的在线状态，连接建立、订阅房间和每次收到 pong 时调用
+// 用户在房间内之前没有存活的连接时向房间广播上线事件，连接过期被清理后恢复心跳也会重新上线
+func (client *Client) refreshPresence(roomIds ...string) {
+	ctx := context.Background()
+	now := utils.GetUTCMillisTimestamp()
+	expiresAt := float64(now + constant.PresenceExpire.Milliseconds())
+	userKey := presenceUserKey(client.UserId)
+
+	pipeline := global.CHAT_REDIS.TxPipeline()
+	pipeline.ZAdd(ctx, userKey, &redis.Z{Score: expiresAt, Member: client.connId})
+	// 集合本身也设置过期时间，所有连接都不再心跳后自动删除
+	pipeline.Expire(ctx, userKey, constant.PresenceExpire)
+	liveCmds := make([]*redis.IntCmd, 0, len(roomIds))
+	for _, roomId := range roomIds {
+		connKey := presenceConnKey(roomId, client.UserId)
+		roomKey := presenceRoomKey(roomId)
+		liveCmds = append(liveCmds, pipeline.ZCount(ctx, connKey, fmt.Sprintf("(%d", now), "+inf"))
+		pipeline.ZAdd(ctx, connKey, &redis.Z{Score: expiresAt, Member: client.connId})
+		pipeline.ZAdd(ctx, roomKey, &redis.Z{Score: expiresAt, Member: client.UserId})
+		pipeline.Expire(ctx, connKey, constant.PresenceExpire)
+		pipeline.Expire(ctx, roomKey, constant.PresenceExpire)
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		global.CHAT_LOG.Warn("refreshPresence-->更新在线状态失败", "user_id", client.UserId, "room_ids", roomIds, "err", err)
+		return
+	}
+	for i, roomId := range roomIds {
+		if liveCmds[i].Val() == 0 {
+			client.Manager.broadcastPresence(roomId, client.UserId, constant.PresenceStatusOnline, 0)
+		}
+	}
+}
+
+// leavePresence 取消订阅或连接断开时移除连接在房间内的在线状态，用户在房间内没有其他连接时向房间广播离线事件
+func (client *Client) leavePresence(roomId string) {
+	ctx := context.Background()
+	now := utils.GetUTCMillisTimestamp()
+	offline, err := leavePresenceScript.Run(ctx, global.CHAT_REDIS,
+		[]string{presenceConnKey(roomId, client.UserId), presenceRoomKey(roomId)},
+		client.connId, client.UserId, now,
+	).Int64()
+	if err != nil {
+		global.CHAT_LOG.Warn("leavePresence-->移除在线状态失败", "user_id", client.UserId, "room_id", roomId, "err", err)
+		return
+	}
+	if offline == 1 {
+		client.Manager.broadcastPresence(roomId, client.UserId, constant.PresenceStatusOffline, now)
+	}
+}
+
+// leaveUserPresence 连接断开时移除连接的全局在线状态，用户没有其他连接时记录最后在线时间
+func (client *Client) leaveUserPresence() {
+	ctx := context.Background()
+	now := utils.GetUTCMillisTimestamp()
+	if err := global.CHAT_REDIS.ZRem(ctx, presenceUserKey(client.UserId), client.connId).Err(); err != nil {
+		global.CHAT_LOG.Warn("leaveUserPresence-->移除在线状态失败", "user_id", client.UserId, "err", err)
+		return
+	}
+	client.Manager.recordLastSeen(ctx, client.UserId, now, now)
+}
+
+// sweepPresence 清理房间内已过期的在线状态并广播离线事件，用于节点宕机后没有正常断开的连接
+// 每个节点只清理本节点有连接的房间，多个节点同时清理时只有移除成功的节点广播
+func (manager *WebSocketManager) sweepPresence(roomIds []string) {
+	ctx := context.Background()
+	now := utils.GetUTCMillisTimestamp()
+	for _, roomId := range roomIds {
+		roomKey := presenceRoomKey(roomId)
+		expired, err := global.CHAT_REDIS.ZRangeByScoreWithScores(ctx, roomKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(now, 10),
+		}).Result()
+		if err != nil {
+			global.CHAT_LOG.Warn("sweepPresence-->查询过期的在线状态失败", "room_id", roomId, "err", err)
+			continue
+		}
+		for _, member := range expired {
+			userId, _ := member.Member.(string)
+			removed, err := sweepPresenceScript.Run(ctx, global.CHAT_REDIS,
+				[]string{roomKey, presenceConnKey(roomId, userId)}, userId, now,
+			).Int64()
+			if err != nil {
+				global.CHAT_LOG.Warn("sweepPresence-->清理过期的在线状态失败", "room_id", roomId, "user_id", userId, "err", err)
+				continue
+			}
+			if removed == 0 {
+				continue
+			}
+			// 最后一次心跳的时间作为最后在线时间
+			lastSeenAt := int64(member.Score) - constant.PresenceExpire.Milliseconds()
+			manager.recordLastSeen(ctx, userId, lastSeenAt, now)
+			manager.broadcastPresence(roomId, userId, constant.PresenceStatusOffline, lastSeenAt)
+		}
+	}
+}
+
+// recordLastSeen 用户在所有房间都没有存活的连接时记录最后在线时间
+func (manager *WebSocketManager) recordLastSeen(ctx context.Context, userId string, lastSeenAt, now int64) {
+	userKey := presenceUserKey(userId)
+	live, err := global.CHAT_REDIS.ZCount(ctx, userKey, fmt.Sprintf("(%d", now), "+inf").Result()
+	if err != nil || live > 0 {
+		return
+	}
+	pipeline := global.CHAT_REDIS.Pipeline()
+	pipeline.ZRemRangeByScore(ctx, userKey, "-inf", strconv.FormatInt(now, 10))
+	pipeline.HSet(ctx, constant.PresenceLastSeenKey, userId, lastSeenAt)
+	if _, err := pipeline.Exec(ctx); err != nil {
+		global.CHAT_LOG.Warn("recordLastSeen-->记录最后在线时间失败", "user_id", userId, "err", err)
+	}
+}
+
+// broadcastPresence 向房间内的其他成员广播上线或离线事件，不持久化
+func (manager *WebSocketManager) broadcastPresence(roomId, userId, status string, lastSeenAt int64) {
+	content := map[string]interface{}{
+		"user_id": userId,
+		"status":  status,
+	}
+	if lastSeenAt > 0 {
+		content["last_seen_at"] = lastSeenAt
+	}
+	manager.SendToRoomExcept(roomId, userId, &WebSocketMessage{
+		Type:      constant.MessageTypePresence,
+		RoomId:    roomId,
+		SenderId:  userId,
+		Content:   content,
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	})
+}
+
+// localRooms 本节点有连接的房间
+func (manager *WebSocketManager) localRooms() []string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	roomIds := make([]string, 0, len(manager.Rooms))
+	for roomId := range manager.Rooms {
+		roomIds = append(roomIds, roomId)
+	}
+	return roomIds
+}
+
+// presenceRoomKey 房间在线用户在 Redis 中的 key
+func presenceRoomKey(roomId string) string {
+	return fmt.Sprintf("%s:%s", constant.PresenceRoomPrefix, roomId)
+}
+
+// presenceConnKey 用户在房间内的连接在 Redis 中的 key
+func presenceConnKey(roomId, userId string) string {
+	return fmt.Sprintf("%s:%s:%s", constant.PresenceConnPrefix, roomId, userId)
+}
+
+// presenceUserKey 用户所有连接在 Redis 中的 key
+func presenceUserKey(userId string) string {
+	return fmt.Sprintf("%s:%s", constant.PresenceUserPrefix, userId)
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const readCursorsColl = "read_cursors"
+
+// RoomUnread 房间未读数，没有已读位置时从加入房间开始统计
+type RoomUnread struct {
+	RoomId            string `json:"room_id"`
+	UnreadCount       int64  `json:"unread_count"`
+	LastReadMessageId string `json:"last_read_message_id,omitempty"`
+	LastReadAt        int64  `json:"last_read_at,omitempty"`
+}
+
+// MarkRead 把用户在房间内的已读位置推进到指定消息，已读位置只前进不后退
+// 位置前进时向房间广播 receipt 事件，返回当前的已读位置
+func (s *MessageService) MarkRead(userId, roomId, messageId string) (*model.ReadCursors, error) {
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, roomId); err != nil {
+		return nil, err
+	}
+	if _, err := bson.ObjectIDFromHex(messageId); err != nil {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	ctx := context.Background()
+	cursor, err := s.parseCursor(ctx, roomId, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := utils.GetUTCMillisTimestamp()
+	readCursor := model.ReadCursors{UserId: userId, RoomId: roomId, MessageId: *cursor.ID, ReadAt: cursor.CreatedAt, UpdatedAt: now}
+	// 只有已读位置早于新位置时才更新；已有更新的位置时条件不匹配，upsert 会因唯一索引冲突而失败
+	_, err = global.CHAT_MONGODB.Collection(readCursorsColl).UpdateOne(ctx,
+		bson.D{{Key: "user_id", Value: userId}, {Key: "room_id", Value: roomId}, {Key: "$or", Value: bson.A{
+			bson.D{{Key: "read_at", Value: bson.D{{Key: "$lt", Value: cursor.CreatedAt}}}},
+			bson.D{{Key: "read_at", Value: cursor.CreatedAt}, {Key: "message_id", Value: bson.D{{Key: "$lt", Value: *cursor.ID}}}},
+		}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "message_id", Value: readCursor.MessageId},
+			{Key: "read_at", Value: readCursor.ReadAt},
+			{Key: "updated_at", Value: readCursor.UpdatedAt},
+		}}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		current, err := s.getReadCursor(ctx, userId, roomId)
+		if err != nil {
+			return nil, err
+		}
+		return current, nil
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("MarkRead-->更新已读位置失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	// 删除缓存而不是直接写入，避免并发推进时旧位置覆盖新位置
+	cacheKey := fmt.Sprintf("%s:%s", constant.ReadCursorPrefix, userId)
+	if err := global.CHAT_REDIS.HDel(ctx, cacheKey, roomId).Err(); err != nil {
+		global.CHAT_LOG.Warn("MarkRead-->删除已读位置缓存失败", "err", err)
+	}
+	broadcastRoomEvent(constant.MessageTypeReceipt, roomId, userId, map[string]interface{}{
+		"message_id": readCursor.MessageId.Hex(),
+		"read_at":    readCursor.ReadAt,
+	})
+	return &readCursor, nil
+}
+
+// ListUnreadCounts 统计用户加入的每个房间的未读数，只统计其他人发送的未删除用户消息
+func (s *MessageService) ListUnreadCounts(userId string) ([]RoomUnread, error) {
+	var members []model.RoomMembers
+	err := global.CHAT_MYSQL.
+		Joins("JOIN room ON room.id = room_members.room_id").
+		Where("room_members.user_id = ? AND room.is_delete = ?", userId, false).
+		Find(&members).Error
+	if err != nil {
+		global.CHAT_LOG.Error("ListUnreadCounts-->查询房间成员，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	if len(members) == 0 {
+		return []RoomUnread{}, nil
+	}
+
+	ctx := context.Background()
+	roomIds := make([]string, 0, len(members))
+	for _, member := range members {
+		roomIds = append(roomIds, member.RoomID)
+	}
+	cursors, err := s.loadReadCursors(ctx, userId, roomIds)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RoomUnread, 0, len(members))
+	for _, member := range members {
+		unread := RoomUnread{RoomId: member.RoomID}
+		filter := bson.D{
+			{Key: "room_id", Value: member.RoomID},
+			{Key: "sender_id", Value: bson.D{{Key: "$ne", Value: userId}}},
+			{Key: "is_deleted", Value: bson.D{{Key: "$ne", Value: true}}},
+		}
+		if cursor, ok := cursors[member.RoomID]; ok {
+			unread.LastReadMessageId = cursor.MessageId.Hex()
+			unread.LastReadAt = cursor.ReadAt
+			filter = append(filter, cursorFilter(&messageCursor{CreatedAt: cursor.ReadAt, ID: &cursor.MessageId}, false)...)
+		} else {
+			filter = append(filter, bson.E{Key: "created_at", Value: bson.D{{Key: "$gte", Value: member.JoinedAt}}})
+		}
+		count, err := global.CHAT_MONGODB.Collection(userMessagesColl).CountDocuments(ctx, filter,
+			options.Count().SetLimit(constant.MaxUnreadCount))
+		if err != nil {
+			global.CHAT_LOG.Error("ListUnreadCounts-->统计未读数失败", "room_id", member.RoomID, "err", err)
+			return nil, common.NewServiceError(common.ERROR)
+		}
+		unread.UnreadCount = count
+		result = append(result, unread)
+	}
+	return result, nil
+}
+
+// getReadCursor 查询用户在房间内的已读位置
+func (s *MessageService) getReadCursor(ctx context.Context, userId, roomId string) (*model.ReadCursors, error) {
+	cursors, err := s.loadReadCursors(ctx, userId, []string{roomId})
+	if err != nil {
+		return nil, err
+	}
+	cursor, ok := cursors[roomId]
+	if !ok {
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return &cursor, nil
+}
+
+// loadReadCursors 批量读取已读位置，先读 Redis 缓存，缓存中没有的从 MongoDB 读取后回填
+func (s *MessageService) loadReadCursors(ctx context.Context, userId string, roomIds []string) (map[string]model.ReadCursors, error) {
+	cursors := make(map[string]model.ReadCursors, len(roomIds))
+	cacheKey := fmt.Sprintf("%s:%s", constant.ReadCursorPrefix, userId)
+	values, err := global.CHAT_REDIS.HMGet(ctx, cacheKey, roomIds...).Result()
+	if err != nil {
+		// 缓存不可用时全部从 MongoDB 读取
+		global.CHAT_LOG.Warn("loadReadCursors-->读取已读位置缓存失败", "err", err)
+		values = make([]interface{}, len(roomIds))
+	}
+
+	var missing []string
+	for i, roomId := range roomIds {
+		value, _ := values[i].(string)
+		if cursor, ok := parseCachedReadCursor(userId, roomId, value); ok {
+			cursors[roomId] = cursor
+			continue
+		}
+		missing = append(missing, roomId)
+	}
+	if len(missing) == 0 {
+		return cursors, nil
+	}
+
+	var stored []model.ReadCursors
+	filter := bson.D{{Key: "user_id", Value: userId}, {Key: "room_id", Value: bson.D{{Key: "$in", Value: missing}}}}
+	if err := findAll(ctx, readCursorsColl, filter, options.Find(), &stored); err != nil {
+		return nil, err
+	}
+	for _, cursor := range stored {
+		cursors[cursor.RoomId] = cursor
+	}
+	cacheReadCursors(ctx, userId, stored...)
+	return cursors, nil
+}
+
+// cacheReadCursors 回填已读位置缓存，值为 read_at:message_id
+func cacheReadCursors(ctx context.Context, userId string, cursors ...model.ReadCursors) {
+	if len(cursors) == 0 {
+		return
+	}
+	cacheKey := fmt.Sprintf("%s:%s", constant.ReadCursorPrefix, userId)
+	fields := make(map[string]interface{}, len(cursors))
+	for _, cursor := range cursors {
+		fields[cursor.RoomId] = fmt.Sprintf("%d:%s", cursor.ReadAt, cursor.MessageId.Hex())
+	}
+	pipeline := global.CHAT_REDIS.TxPipeline()
+	pipeline.HSet(ctx, cacheKey, fields)
+	pipeline.Expire(ctx, cacheKey, constant.ReadCursorExpire)
+	if _, err := pipeline.Exec(ctx); err != nil {
+		global.CHAT_LOG.Warn("cacheReadCursors-->写入已读位置缓存失败", "err", err)
+	}
+}
+
+// parseCachedReadCursor 解析缓存中的已读位置
+func parseCachedReadCursor(userId, roomId, value string) (model.ReadCursors, bool) {
+	readAtValue, messageIdValue, found := strings.Cut(value, ":")
+	if !found {
+		return model.ReadCursors{}, false
+	}
+	readAt, err := strconv.ParseInt(readAtValue, 10, 64)
+	if err != nil {
+		return model.ReadCursors{}, false
+	}
+	messageId, err := bson.ObjectIDFromHex(messageIdValue)
+	if err != nil {
+		return model.ReadCursors{}, false
+	}
+	return model.ReadCursors{UserId: userId, RoomId: roomId, MessageId: messageId, ReadAt: readAt}, true
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// rolePermissions 各角色拥有的房间权限
+var rolePermissions = map[string]map[string]bool{
+	constant.RoomRoleOwner: {
+		constant.RoomPermissionSendMessage:        true,
+		constant.RoomPermissionPostAnnouncement:   true,
+		constant.RoomPermissionUpdateRoom:         true,
+		constant.RoomPermissionDeleteRoom:         true,
+		constant.RoomPermissionKickMember:         true,
+		constant.RoomPermissionManageInvites:      true,
+		constant.RoomPermissionHandleJoinRequests: true,
+		constant.RoomPermissionManageRoles:        true,
+	},
+	constant.RoomRoleAdmin: {
+		constant.RoomPermissionSendMessage:        true,
+		constant.RoomPermissionPostAnnouncement:   true,
+		constant.RoomPermissionUpdateRoom:         true,
+		constant.RoomPermissionKickMember:         true,
+		constant.RoomPermissionManageInvites:      true,
+		constant.RoomPermissionHandleJoinRequests: true,
+	},
+	constant.RoomRoleMember: {
+		constant.RoomPermissionSendMessage: true,
+	},
+	constant.RoomRoleReadOnly: {},
+}
+
+// roleRank 角色等级，只能管理等级比自己低的成员
+var roleRank = map[string]int{
+	constant.RoomRoleOwner:    4,
+	constant.RoomRoleAdmin:    3,
+	constant.RoomRoleMember:   2,
+	constant.RoomRoleReadOnly: 1,
+}
+
+// CheckPermission 校验用户在房间内是否拥有指定权限，通过时返回房间和成员信息
+// 公告房间发送消息需要额外的发布公告权限
+func (s *RoomService) CheckPermission(userId, roomId, permission string) (*model.Room, *model.RoomMembers, error) {
+	room, err := s.getActiveRoom(roomId)
+	if err != nil {
+		return nil, nil, err
+	}
+	member, err := s.getMember(room, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasPermission(room, member.Role, permission) {
+		return nil, nil, common.NewServiceError(common.ROOM_PERMISSION_DENIED)
+	}
+	return room, member, nil
+}
+
+// SetMemberRole 修改成员角色，不能修改房主的角色
+func (s *RoomService) SetMemberRole(operatorId, roomId, targetUserId, role string) error {
+	room, _, err := s.CheckPermission(operatorId, roomId, constant.RoomPermissionManageRoles)
+	if err != nil {
+		return err
+	}
+	if _, ok := roleRank[role]; !ok || role == constant.RoomRoleOwner {
+		return common.NewServiceError(common.INVALID_PARAMS)
+	}
+	target, err := s.getMember(room, targetUserId)
+	if err != nil {
+		return err
+	}
+	if target.Role == constant.RoomRoleOwner {
+		return common.NewServiceError(common.ROOM_PERMISSION_DENIED)
+	}
+
+	err = global.CHAT_MYSQL.Model(&model.RoomMembers{}).
+		Where("user_id = ? AND room_id = ?", targetUserId, roomId).
+		Update("role", role).Error
+	if err != nil {
+		global.CHAT_LOG.Error("SetMemberRole-->修改成员角色，数据库操作错误", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	return nil
+}
+
+// getMember 获取房间成员信息，房间创建者始终视为房主，私聊房间没有房主
+func (s *RoomService) getMember(room *model.Room, userId string) (*model.RoomMembers, error) {
+	var member model.RoomMembers
+	err := global.CHAT_MYSQL.Where("user_id = ? AND room_id = ?", userId, room.ID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.NewServiceError(common.ROOM_NOT_MEMBER)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("getMember-->查询房间成员，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	if room.CreatorID == userId && !room.IsDirect {
+		member.Role = constant.RoomRoleOwner
+	} else if _, ok := roleRank[member.Role]; !ok {
+		member.Role = constant.RoomRoleMember
+	}
+	return &member, nil
+}
+
+// hasPermission 判断角色是否拥有权限
+func hasPermission(room *model.Room, role, permission string) bool {
+	if !rolePermissions[role][permission] {
+		return false
+	}
+	if permission == constant.RoomPermissionSendMessage && room.IsAnnouncement {
+		return rolePermissions[role][constant.RoomPermissionPostAnnouncement]
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/model"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	normalRoom := &model.Room{}
+	announcementRoom := &model.Room{IsAnnouncement: true}
+	tests := []struct {
+		name       string
+		room       *model.Room
+		role       string
+		permission string
+		want       bool
+	}{
+		{"房主可以删除房间", normalRoom, constant.RoomRoleOwner, constant.RoomPermissionDeleteRoom, true},
+		{"房主可以修改角色", normalRoom, constant.RoomRoleOwner, constant.RoomPermissionManageRoles, true},
+		{"管理员不能删除房间", normalRoom, constant.RoomRoleAdmin, constant.RoomPermissionDeleteRoom, false},
+		{"管理员不能修改角色", normalRoom, constant.RoomRoleAdmin, constant.RoomPermissionManageRoles, false},
+		{"管理员可以移出成员", normalRoom, constant.RoomRoleAdmin, constant.RoomPermissionKickMember, true},
+		{"管理员可以审核加入申请", normalRoom, constant.RoomRoleAdmin, constant.RoomPermissionHandleJoinRequests, true},
+		{"普通成员可以发言", normalRoom, constant.RoomRoleMember, constant.RoomPermissionSendMessage, true},
+		{"普通成员不能移出成员", normalRoom, constant.RoomRoleMember, constant.RoomPermissionKickMember, false},
+		{"普通成员不能管理邀请", normalRoom, constant.RoomRoleMember, constant.RoomPermissionManageInvites, false},
+		{"只读成员不能发言", normalRoom, constant.RoomRoleReadOnly, constant.RoomPermissionSendMessage, false},
+		{"公告房间房主可以发言", announcementRoom, constant.RoomRoleOwner, constant.RoomPermissionSendMessage, true},
+		{"公告房间管理员可以发言", announcementRoom, constant.RoomRoleAdmin, constant.RoomPermissionSendMessage, true},
+		{"公告房间普通成员不能发言", announcementRoom, constant.RoomRoleMember, constant.RoomPermissionSendMessage, false},
+		{"公告房间不影响其他权限", announcementRoom, constant.RoomRoleAdmin, constant.RoomPermissionUpdateRoom, true},
+		{"未知角色没有权限", normalRoom, "guest", constant.RoomPermissionSendMessage, false},
+		{"未知权限", normalRoom, constant.RoomRoleOwner, "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasPermission(tt.room, tt.role, tt.permission); got != tt.want {
+				t.Errorf("hasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleRank(t *testing.T) {
+	// 等级从高到低，只能管理等级比自己低的成员
+	ordered := []string{constant.RoomRoleOwner, constant.RoomRoleAdmin, constant.RoomRoleMember, constant.RoomRoleReadOnly}
+	for i := 0; i+1 < len(ordered); i++ {
+		if roleRank[ordered[i]] <= roleRank[ordered[i+1]] {
+			t.Errorf("roleRank[%q]=%d 应该高于 roleRank[%q]=%d", ordered[i], roleRank[ordered[i]], ordered[i+1], roleRank[ordered[i+1]])
+		}
+	}
+	if _, ok := roleRank["guest"]; ok {
+		t.Error("未知角色不应该有等级")
+	}
+}
+
+func TestRolePermissionsCoverRoles(t *testing.T) {
+	// 每个有等级的角色都需要配置权限，等级高的角色拥有等级低的角色的全部权限
+	for role := range roleRank {
+		if _, ok := rolePermissions[role]; !ok {
+			t.Errorf("角色 %q 没有配置权限", role)
+		}
+	}
+	for higher, higherRank := range roleRank {
+		for lower, lowerRank := range roleRank {
+			if higherRank <= lowerRank {
+				continue
+			}
+			for permission := range rolePermissions[lower] {
+				if !rolePermissions[higher][permission] {
+					t.Errorf("角色 %q 缺少等级更低的角色 %q 的权限 %q", higher, lower, permission)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"chat-server/model"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"errors"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoomService struct{}
+
+// mysqlDuplicateEntry MySQL 唯一索引冲突的错误码
+const mysqlDuplicateEntry = 1062
+
+// CreateRoom 创建房间，创建者同时成为房间成员
+func (s *RoomService) CreateRoom(userId, roomName string, isPrivate bool) (*model.Room, error) {
+	now := utils.GetUTCMillisTimestamp()
+	room := model.Room{
+		ID:        uuid.New().String(),
+		RoomName:  roomName,
+		CreatorID: userId,
+		IsPrivate: isPrivate,
+		IsDelete:  false,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	member := model.RoomMembers{
+		ID:       uuid.New().String(),
+		UserID:   userId,
+		RoomID:   room.ID,
+		Role:     constant.RoomRoleOwner,
+		JoinedAt: now,
+	}
+
+	err := global.CHAT_MYSQL.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&room).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(&member).Error
+	})
+	if err != nil {
+		global.CHAT_LOG.Error("CreateRoom-->创建房间，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	return &room, nil
+}
+
+// GetRoom 获取房间信息，私有房间只有成员可以查看
+func (s *RoomService) GetRoom(userId, roomId string) (*model.Room, error) {
+	room, err := s.getActiveRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	if room.IsPrivate {
+		isMember, err := s.IsRoomMember(userId, roomId)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, common.NewServiceError(common.ROOM_NOT_MEMBER)
+		}
+	}
+	return room, nil
+}
+
+// ListMyRooms 获取当前用户加入的所有未删除房间
+func (s *RoomService) ListMyRooms(userId string) ([]model.Room, error) {
+	rooms := make([]model.Room, 0)
+	err := global.CHAT_MYSQL.
+		Joins("JOIN room_members ON room_members.room_id = room.id").
+		Where("room_members.user_id = ? AND room.is_delete = ?", userId, false).
+		Order("room.updated_at DESC").
+		Find(&rooms).Error
+	if err != nil {
+		global.CHAT_LOG.Error("ListMyRooms-->查询房间列表，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return rooms, nil
+}
+
+// UpdateRoom 修改房间名称、私有属性或公告属性，需要修改房间权限
+func (s *RoomService) UpdateRoom(userId, roomId string, roomName *string, isPrivate, isAnnouncement *bool) (*model.Room, error) {
+	room, _, err := s.CheckPermission(userId, roomId, constant.RoomPermissionUpdateRoom)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if roomName != nil {
+		updates["room_name"] = *roomName
+		room.RoomName = *roomName
+	}
+	if isPrivate != nil {
+		updates["is_private"] = *isPrivate
+		room.IsPrivate = *isPrivate
+	}
+	if isAnnouncement != nil {
+		updates["is_announcement"] = *isAnnouncement
+		room.IsAnnouncement = *isAnnouncement
+	}
+	if len(updates) == 0 {
+		return room, nil
+	}
+	room.UpdatedAt = utils.GetUTCMillisTimestamp()
+	updates["updated_at"] = room.UpdatedAt
+
+	if err := global.CHAT_MYSQL.Model(&model.Room{}).Where("id = ?", roomId).Updates(updates).Error; err != nil {
+		global.CHAT_LOG.Error("UpdateRoom-->修改房间信息，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return room, nil
+}
+
+// DeleteRoom 软删除房间，只有房主可以删除
+func (s *RoomService) DeleteRoom(userId, roomId string) error {
+	_, _, err := s.CheckPermission(userId, roomId, constant.RoomPermissionDeleteRoom)
+	if err != nil {
+		return err
+	}
+
+	err = global.CHAT_MYSQL.Model(&model.Room{}).Where("id = ?", roomId).Updates(map[string]interface{}{
+		"is_delete":  true,
+		"updated_at": utils.GetUTCMillisTimestamp(),
+	}).Error
+	if err != nil {
+		global.CHAT_LOG.Error("DeleteRoom-->删除房间，数据库操作错误", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+
+	// 先通知房间内的连接，再取消所有节点上对房间的订阅
+	broadcastSystemMessage(constant.MessageTypeSystem, roomId, userId, constant.DeleteRoomMessageContent)
+	disconnectRoom(roomId)
+	return nil
+}
+
+// IsRoomMember 判断用户是否为房间成员
+func (s *RoomService) IsRoomMember(userId, roomId string) (bool, error) {
+	var count int64
+	err := global.CHAT_MYSQL.Model(&model.RoomMembers{}).
+		Where("user_id = ? AND room_id = ?", userId, roomId).
+		Count(&count).Error
+	if err != nil {
+		global.CHAT_LOG.Error("IsRoomMember-->查询房间成员，数据库操作错误", "err", err)
+		return false, common.NewServiceError(common.ERROR)
+	}
+	return count > 0, nil
+}
+
+// filterRoomMembers 从用户列表中筛选出房间成员，保持原有顺序
+func (s *RoomService) filterRoomMembers(roomId string, userIds []string) ([]string, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	var memberIds []string
+	err := global.CHAT_MYSQL.Model(&model.RoomMembers{}).
+		Where("room_id = ? AND user_id IN ?", roomId, userIds).
+		Pluck("user_id", &memberIds).Error
+	if err != nil {
+		global.CHAT_LOG.Error("filterRoomMembers-->查询房间成员，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	isMember := make(map[string]bool, len(memberIds))
+	for _, memberId := range memberIds {
+		isMember[memberId] = true
+	}
+	result := make([]string, 0, len(memberIds))
+	for _, userId := range userIds {
+		if isMember[userId] {
+			result = append(result, userId)
+		}
+	}
+	return result, nil
+}
+
+// CheckRoomMember 校验房间存在且未删除，并且用户是房间成员
+func (s *RoomService) CheckRoomMember(userId, roomId string) error {
+	if _, err := s.getActiveRoom(roomId); err != nil {
+		return err
+	}
+	isMember, err := s.IsRoomMember(userId, roomId)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return common.NewServiceError(common.ROOM_NOT_MEMBER)
+	}
+	return nil
+}
+
+// ListMembers 获取房间成员列表，只有成员可以查看
+func (s *RoomService) ListMembers(userId, roomId string) ([]model.RoomMembers, error) {
+	if err := s.CheckRoomMember(userId, roomId); err != nil {
+		return nil, err
+	}
+	members := make([]model.RoomMembers, 0)
+	err := global.CHAT_MYSQL.Where("room_id = ?", roomId).Order("joined_at ASC").Find(&members).Error
+	if err != nil {
+		global.CHAT_LOG.Error("ListMembers-->查询房间成员，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return members, nil
+}
+
+// JoinRoom 加入房间，公开房间直接加入，私有房间提交加入申请等待房主或管理员审核
+// 直接加入时返回的申请为nil
+func (s *RoomService) JoinRoom(userId, roomId string) (*model.RoomJoinRequest, error) {
+	room, err := s.getActiveRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := s.IsRoomMember(userId, roomId)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return nil, common.NewServiceError(common.ROOM_ALREADY_MEMBER)
+	}
+	// 私聊房间不允许其他人加入
+	if room.IsDirect {
+		return nil, common.NewServiceError(common.ROOM_PERMISSION_DENIED)
+	}
+
+	// 公开房间直接加入
+	if !room.IsPrivate {
+		if err := s.addMember(global.CHAT_MYSQL, userId, roomId); err != nil {
+			return nil, err
+		}
+		broadcastSystemMessage(constant.MessageTypeJoin, roomId, userId, constant.JoinMessageContent)
+		return nil, nil
+	}
+
+	// 私有房间提交加入申请
+	var count int64
+	err = global.CHAT_MYSQL.Model(&model.RoomJoinRequest{}).
+		Where("room_id = ? AND user_id = ? AND status = ?", roomId, userId, constant.JoinRequestStatusPending).
+		Count(&count).Error
+	if err != nil {
+		global.CHAT_LOG.Error("JoinRoom-->查询加入申请，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	if count > 0 {
+		return nil, common.NewServiceError(common.JOIN_REQUEST_EXISTS)
+	}
+	joinRequest := model.RoomJoinRequest{
+		ID:        uuid.New().String(),
+		RoomID:    roomId,
+		UserID:    userId,
+		Status:    constant.JoinRequestStatusPending,
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}
+	if err := global.CHAT_MYSQL.Create(&joinRequest).Error; err != nil {
+		global.CHAT_LOG.Error("JoinRoom-->创建加入申请，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return &joinRequest, nil
+}
+
+// LeaveRoom 退出房间，房主不能退出，只能删除房间
+func (s *RoomService) LeaveRoom(userId, roomId string) error {
+	room, err := s.getActiveRoom(roomId)
+	if err != nil {
+		return err
+	}
+	if room.IsDirect {
+		return common.NewServiceError(common.ROOM_PERMISSION_DENIED)
+	}
+	if room.CreatorID == userId {
+		return common.NewServiceError(common.ROOM_CREATOR_LEAVE)
+	}
+	if err := s.removeMember(userId, roomId); err != nil {
+		return err
+	}
+	disconnectUserFromRoom(userId, roomId)
+	broadcastSystemMessage(constant.MessageTypeLeave, roomId, userId, constant.LeaveMessageContent)
+	return nil
+}
+
+// KickMember 将成员移出房间，需要移出成员权限，且只能移出角色等级比自己低的成员
+func (s *RoomService) KickMember(operatorId, roomId, targetUserId string) error {
+	room, operator, err := s.CheckPermission(operatorId, roomId, constant.RoomPermissionKickMember)
+	if err != nil {
+		return err
+	}
+	target, err := s.getMember(room, targetUserId)
+	if err != nil {
+		return err
+	}
+	if roleRank[target.Role] >= roleRank[operator.Role] {
+		return common.NewServiceError(common.ROOM_PERMISSION_DENIED)
+	}
+	if err := s.removeMember(targetUserId, roomId); err != nil {
+		return err
+	}
+	disconnectUserFromRoom(targetUserId, roomId)
+	broadcastSystemMessage(constant.MessageTypeLeave, roomId, targetUserId, constant.KickMessageContent)
+	return nil
+}
+
+// CreateInvite 创建邀请链接，需要管理邀请权限
+// expiresIn为有效时长(秒)，maxUses为最大使用次数，均为0表示不限制
+func (s *RoomService) CreateInvite(userId, roomId string, expiresIn int64, maxUses int) (*model.RoomInvite, error) {
+	if _, _, err := s.CheckPermission(userId, roomId, constant.RoomPermissionManageInvites); err != nil {
+		return nil, err
+	}
+
+	now := utils.GetUTCMillisTimestamp()
+	invite := model.RoomInvite{
+		ID:        uuid.New().String(),
+		RoomID:    roomId,
+		CreatorID: userId,
+		Code:      strings.ReplaceAll(uuid.New().String(), "-", ""),
+		MaxUses:   maxUses,
+		CreatedAt: now,
+	}
+	if expiresIn > 0 {
+		invite.ExpiresAt = now + expiresIn*1000
+	}
+	if err := global.CHAT_MYSQL.Create(&invite).Error; err != nil {
+		global.CHAT_LOG.Error("CreateInvite-->创建邀请，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return &invite, nil
+}
+
+// RevokeInvite 撤销邀请链接，需要管理邀请权限
+func (s *RoomService) RevokeInvite(userId, roomId, inviteId string) error {
+	if _, _, err := s.CheckPermission(userId, roomId, constant.RoomPermissionManageInvites); err != nil {
+		return err
+	}
+	result := global.CHAT_MYSQL.Model(&model.RoomInvite{}).
+		Where("id = ? AND room_id = ?", inviteId, roomId).
+		Update("is_revoked", true)
+	if result.Error != nil {
+		global.CHAT_LOG.Error("RevokeInvite-->撤销邀请，数据库操作错误", "err", result.Error)
+		return common.NewServiceError(common.ERROR)
+	}
+	if result.RowsAffected == 0 {
+		return common.NewServiceError(common.ROOM_INVITE_INVALID)
+	}
+	return nil
+}
+
+// JoinByInvite 通过邀请码加入房间，私有房间也无需审核
+func (s *RoomService) JoinByInvite(userId, code string) (*model.Room, error) {
+	var invite model.RoomInvite
+	err := global.CHAT_MYSQL.Where("code = ?", code).First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.NewServiceError(common.ROOM_INVITE_INVALID)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("JoinByInvite-->查询邀请，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	room, err := s.getActiveRoom(invite.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = global.CHAT_MYSQL.Transaction(func(tx *gorm.DB) error {
+		if err := s.addMember(tx, userId, invite.RoomID); err != nil {
+			return err
+		}
+		// 条件更新使用次数，保证并发时不会超过上限
+		result := tx.Model(&model.RoomInvite{}).
+			Where("id = ? AND is_revoked = ?", invite.ID, false).
+			Where("max_uses = 0 OR used_count < max_uses").
+			Where("expires_at = 0 OR expires_at > ?", utils.GetUTCMillisTimestamp()).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			global.CHAT_LOG.Error("JoinByInvite-->更新邀请使用次数，数据库操作错误", "err", result.Error)
+			return common.NewServiceError(common.ERROR)
+		}
+		if result.RowsAffected == 0 {
+			return common.NewServiceError(common.ROOM_INVITE_INVALID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	broadcastSystemMessage(constant.MessageTypeJoin, room.ID, userId, constant.JoinMessageContent)
+	return room, nil
+}
+
+// ListJoinRequests 获取房间待审核的加入申请，需要审核加入申请权限
+func (s *RoomService) ListJoinRequests(userId, roomId string) ([]model.RoomJoinRequest, error) {
+	if _, _, err := s.CheckPermission(userId, roomId, constant.RoomPermissionHandleJoinRequests); err != nil {
+		return nil, err
+	}
+	joinRequests := make([]model.RoomJoinRequest, 0)
+	err := global.CHAT_MYSQL.
+		Where("room_id = ? AND status = ?", roomId, constant.JoinRequestStatusPending).
+		Order("created_at ASC").
+		Find(&joinRequests).Error
+	if err != nil {
+		global.CHAT_LOG.Error("ListJoinRequests-->查询加入申请，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return joinRequests, nil
+}
+
+// HandleJoinRequest 审核加入申请，需要审核加入申请权限，通过后申请人成为房间成员，申请人已是成员时只标记申请已处理
+func (s *RoomService) HandleJoinRequest(operatorId, roomId, requestId string, approve bool) error {
+	_, _, err := s.CheckPermission(operatorId, roomId, constant.RoomPermissionHandleJoinRequests)
+	if err != nil {
+		return err
+	}
+
+	var joinRequest model.RoomJoinRequest
+	alreadyMember := false
+	status := constant.JoinRequestStatusRejected
+	if approve {
+		status = constant.JoinRequestStatusApproved
+	}
+	err = global.CHAT_MYSQL.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ? AND room_id = ? AND status = ?", requestId, roomId, constant.JoinRequestStatusPending).
+			First(&joinRequest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.NewServiceError(common.JOIN_REQUEST_NOT_FOUND)
+		}
+		if err != nil {
+			global.CHAT_LOG.Error("HandleJoinRequest-->查询加入申请，数据库操作错误", "err", err)
+			return common.NewServiceError(common.ERROR)
+		}
+		// 只更新仍处于待审核状态的申请，防止重复审核
+		result := tx.Model(&model.RoomJoinRequest{}).
+			Where("id = ? AND status = ?", requestId, constant.JoinRequestStatusPending).
+			Updates(map[string]interface{}{
+				"status":     status,
+				"handled_by": operatorId,
+				"handled_at": utils.GetUTCMillisTimestamp(),
+			})
+		if result.Error != nil {
+			global.CHAT_LOG.Error("HandleJoinRequest-->更新加入申请，数据库操作错误", "err", result.Error)
+			return common.NewServiceError(common.ERROR)
+		}
+		if result.RowsAffected == 0 {
+			return common.NewServiceError(common.JOIN_REQUEST_NOT_FOUND)
+		}
+		if !approve {
+			return nil
+		}
+		// 申请人已通过其他方式加入时申请照常标记为已通过，不重复添加
+		err = s.addMember(tx, joinRequest.UserID, roomId)
+		var serviceErr common.ServiceErr
+		if errors.As(err, &serviceErr) && serviceErr.GetResponseCode() == common.ROOM_ALREADY_MEMBER {
+			alreadyMember = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if approve && !alreadyMember {
+		broadcastSystemMessage(constant.MessageTypeJoin, roomId, joinRequest.UserID, constant.JoinMessageContent)
+	}
+	return nil
+}
+
+// GetOrCreateDirectRoom 获取两个用户之间的私聊房间，不存在则创建
+// 房间id由两个用户id排序后拼接而成，保证同一对用户只有一个私聊房间
+func (s *RoomService) GetOrCreateDirectRoom(userId, peerId string) (*model.Room, error) {
+	roomId := directRoomId(userId, peerId)
+	now := utils.GetUTCMillisTimestamp()
+	room := model.Room{
+		ID:        roomId,
+		RoomName:  "",
+		CreatorID: userId,
+		IsPrivate: true,
+		IsDirect:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err := global.CHAT_MYSQL.Transaction(func(tx *gorm.DB) error {
+		// 并发首条消息时只有一个请求能创建成功，其余请求直接使用已存在的房间
+		result := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&room)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		members := []model.RoomMembers{
+			{ID: uuid.New().String(), UserID: userId, RoomID: roomId, Role: constant.RoomRoleMember, JoinedAt: now},
+			{ID: uuid.New().String(), UserID: peerId, RoomID: roomId, Role: constant.RoomRoleMember, JoinedAt: now},
+		}
+		return tx.Omit(clause.Associations).Create(&members).Error
+	})
+	if err != nil {
+		global.CHAT_LOG.Error("GetOrCreateDirectRoom-->创建私聊房间，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	return s.getActiveRoom(roomId)
+}
+
+// directRoomId 生成两个用户之间私聊房间的确定性id
+func directRoomId(userId, peerId string) string {
+	if userId > peerId {
+		userId, peerId = peerId, userId
+	}
+	return "dm_" + userId + "_" + peerId
+}
+
+// addMember 添加房间成员，已是成员则返回错误
+// 并发添加同一成员时由唯一索引(user_id, room_id)保证只有一个成功
+func (s *RoomService) addMember(db *gorm.DB, userId, roomId string) error {
+	var count int64
+	err := db.Model(&model.RoomMembers{}).Where("user_id = ? AND room_id = ?", userId, roomId).Count(&count).Error
+	if err != nil {
+		global.CHAT_LOG.Error("addMember-->查询房间成员，数据库操作错误", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	if count > 0 {
+		return common.NewServiceError(common.ROOM_ALREADY_MEMBER)
+	}
+	member := model.RoomMembers{
+		ID:       uuid.New().String(),
+		UserID:   userId,
+		RoomID:   roomId,
+		Role:     constant.RoomRoleMember,
+		JoinedAt: utils.GetUTCMillisTimestamp(),
+	}
+	if err := db.Omit(clause.Associations).Create(&member).Error; err != nil {
+		if isDuplicateKeyError(err) {
+			return common.NewServiceError(common.ROOM_ALREADY_MEMBER)
+		}
+		global.CHAT_LOG.Error("addMember-->添加房间成员，数据库操作错误", "err", err)
+		return common.NewServiceError(common.ERROR)
+	}
+	return nil
+}
+
+// isDuplicateKeyError 判断是否为 MySQL 唯一索引冲突
+func isDuplicateKeyError(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+// removeMember 删除房间成员，不是成员则返回错误
+func (s *RoomService) removeMember(userId, roomId string) error {
+	result := global.CHAT_MYSQL.Where("user_id = ? AND room_id = ?", userId, roomId).Delete(&model.RoomMembers{})
+	if result.Error != nil {
+		global.CHAT_LOG.Error("removeMember-->删除房间成员，数据库操作错误", "err", result.Error)
+		return common.NewServiceError(common.ERROR)
+	}
+	if result.RowsAffected == 0 {
+		return common.NewServiceError(common.ROOM_NOT_MEMBER)
+	}
+	return nil
+}
+
+// broadcastSystemMessage 通过WebSocket管理器向房间广播成员变更等系统消息
+func broadcastSystemMessage(messageType, roomId, senderId, text string) {
+	manager, ok := global.CHAT_WEBSOCKET_MANAGER.(*WebSocketManager)
+	if !ok {
+		return
+	}
+	if err := manager.BroadcastToRoom(roomId, NewSystemMessage(messageType, roomId, senderId, text)); err != nil {
+		global.CHAT_LOG.Error("broadcastSystemMessage-->广播系统消息失败", "room_id", roomId, "type", messageType, "err", err)
+	}
+}
+
+// disconnectUserFromRoom 取消用户的WebSocket连接对房间的订阅
+func disconnectUserFromRoom(userId, roomId string) {
+	manager, ok := global.CHAT_WEBSOCKET_MANAGER.(*WebSocketManager)
+	if !ok {
+		return
+	}
+	manager.DisconnectUserFromRoom(userId, roomId)
+}
+
+// disconnectRoom 取消所有WebSocket连接对房间的订阅
+func disconnectRoom(roomId string) {
+	manager, ok := global.CHAT_WEBSOCKET_MANAGER.(*WebSocketManager)
+	if !ok {
+		return
+	}
+	manager.DisconnectRoom(roomId)
+}
+
+// getActiveRoom 获取未删除的房间
+func (s *RoomService) getActiveRoom(roomId string) (*model.Room, error) {
+	var room model.Room
+	err := global.CHAT_MYSQL.Where("id = ? AND is_delete = ?", roomId, false).First(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.NewServiceError(common.ROOM_NOT_FOUND)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("getActiveRoom-->查询房间，数据库操作错误", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	return &room, nil
+}
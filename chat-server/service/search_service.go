@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"chat-server/global"
+	"chat-server/model/common"
+	"chat-server/model/request/chat"
+	"context"
+	"encoding/json"
+)
+
+const (
+	defaultSearchPageSize = 20
+	// maxSearchResultWindow ES 默认的 index.max_result_window，from+size 超过时 ES 拒绝查询
+	maxSearchResultWindow = 10000
+	// userMessagesIndex 用户消息的ES索引，由 MongoToEsSync 从 user_messages 集合同步
+	userMessagesIndex = "user_messages"
+)
+
+// searchTextFields 参与全文搜索的字段，每个字段同时匹配分词和ngram子字段
+var searchTextFields = []string{
+	"content.text",
+	"content.reply.text",
+	"content.image.name",
+	"content.file.name",
+	"content.voice.name",
+	"content.video.name",
+}
+
+type SearchService struct{}
+
+// SearchHit 搜索结果中的单条消息，highlights 为各字段的高亮片段
+type SearchHit struct {
+	ID         string              `json:"_id"`
+	RoomId     string              `json:"room_id"`
+	SenderId   string              `json:"sender_id"`
+	Type       string              `json:"type"`
+	Content    json.RawMessage     `json:"content"`
+	CreatedAt  int64               `json:"created_at"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// SearchResult 搜索分页结果
+type SearchResult struct {
+	Total    int64       `json:"total"`
+	Messages []SearchHit `json:"messages"`
+}
+
+// esSearchResponse ES搜索响应中用到的部分
+type esSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			ID        string              `json:"_id"`
+			Score     float64             `json:"_score"`
+			Source    json.RawMessage     `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// SearchMessages 全文搜索用户消息，结果只包含调用者所在房间的消息
+func (s *SearchService) SearchMessages(userId string, req *chat.SearchMessagesRequest) (*SearchResult, error) {
+	if req.StartTime > 0 && req.EndTime > 0 && req.StartTime > req.EndTime {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = defaultSearchPageSize
+	}
+	// 超过 ES 结果窗口的深分页直接拒绝，需要缩小搜索条件
+	if req.Page*req.PageSize > maxSearchResultWindow {
+		return nil, common.NewServiceError(common.INVALID_PARAMS)
+	}
+
+	var roomIds []string
+	if req.RoomId != "" {
+		if err := ServiceGroupApp.RoomService.CheckRoomMember(userId, req.RoomId); err != nil {
+			return nil, err
+		}
+		roomIds = []string{req.RoomId}
+	} else {
+		rooms, err := ServiceGroupApp.RoomService.ListMyRooms(userId)
+		if err != nil {
+			return nil, err
+		}
+		for _, room := range rooms {
+			roomIds = append(roomIds, room.ID)
+		}
+	}
+	result := &SearchResult{Messages: make([]SearchHit, 0)}
+	if len(roomIds) == 0 {
+		return result, nil
+	}
+
+	body, err := json.Marshal(buildSearchQuery(req, roomIds))
+	if err != nil {
+		global.CHAT_LOG.Error("SearchMessages-->构建ES查询失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	res, err := global.CHAT_ES.Search(
+		global.CHAT_ES.Search.WithContext(context.Background()),
+		global.CHAT_ES.Search.WithIndex(userMessagesIndex),
+		global.CHAT_ES.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		global.CHAT_LOG.Error("SearchMessages-->ES搜索请求失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		global.CHAT_LOG.Error("SearchMessages-->ES搜索返回错误", "status", res.Status(), "response", res.String())
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	var esRes esSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&esRes); err != nil {
+		global.CHAT_LOG.Error("SearchMessages-->解析ES搜索响应失败", "err", err)
+		return nil, common.NewServiceError(common.ERROR)
+	}
+
+	result.Total = esRes.Hits.Total.Value
+	for _, hit := range esRes.Hits.Hits {
+		var message SearchHit
+		if err := json.Unmarshal(hit.Source, &message); err != nil {
+			global.CHAT_LOG.Warn("SearchMessages-->解析ES文档失败，跳过", "id", hit.ID, "err", err)
+			continue
+		}
+		message.ID = hit.ID
+		message.Score = hit.Score
+		message.Highlights = hit.Highlight
+		result.Messages = append(result.Messages, message)
+	}
+	return result, nil
+}
+
+// buildSearchQuery 构建ES查询：关键词匹配分词字段和ngram子字段，房间、发送者、类型、时间作为过滤条件
+func buildSearchQuery(req *chat.SearchMessagesRequest, roomIds []string) map[string]interface{} {
+	fields := make([]string, 0, len(searchTextFields)*2)
+	highlightFields := make(map[string]interface{}, len(searchTextFields)*2)
+	for _, field := range searchTextFields {
+		// 分词匹配的权重高于ngram匹配
+		fields = append(fields, field+"^3", field+".ngram")
+		highlightFields[field] = map[string]interface{}{}
+		highlightFields[field+".ngram"] = map[string]interface{}{}
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"terms": map[string]interface{}{"room_id": roomIds}},
+	}
+	if req.SenderId != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"sender_id": req.SenderId}})
+	}
+	if req.Type != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"type": req.Type}})
+	}
+	if req.StartTime > 0 || req.EndTime > 0 {
+		createdAt := map[string]interface{}{}
+		if req.StartTime > 0 {
+			createdAt["gte"] = req.StartTime
+		}
+		if req.EndTime > 0 {
+			createdAt["lte"] = req.EndTime
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"created_at": createdAt}})
+	}
+
+	return map[string]interface{}{
+		"from": (req.Page - 1) * req.PageSize,
+		"size": req.PageSize,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []interface{}{
+					map[string]interface{}{"multi_match": map[string]interface{}{
+						"query":  req.Keyword,
+						"fields": fields,
+						"type":   "most_fields",
+					}},
+				},
+				"filter": filters,
+				// 已删除的消息不参与搜索
+				"must_not": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"is_deleted": true}},
+				},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"_score": "desc"},
+			map[string]interface{}{"created_at": "desc"},
+		},
+		"highlight": map[string]interface{}{
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields":    highlightFields,
+		},
+	}
+}
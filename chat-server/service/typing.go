@@ -0,0 +1,87 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"time"
+)
+
+// handleTyping 处理正在输入帧，content 中 action 为 start 或 stop
+// start 需要客户端在 TypingExpire 内持续刷新，否则服务端自动广播 stop
+func (client *Client) handleTyping(wsMessage *WebSocketMessage) error {
+	contentMap, ok := wsMessage.Content.(map[string]interface{})
+	if !ok {
+		return common.NewServiceError(common.MESSAGE_INVALID)
+	}
+	switch utils.GetStringValue(contentMap, "action") {
+	case constant.TypingActionStart:
+		client.startTyping(wsMessage.RoomId)
+	case constant.TypingActionStop:
+		client.stopTyping(wsMessage.RoomId)
+	default:
+		return common.NewServiceError(common.INVALID_PARAMS)
+	}
+	return nil
+}
+
+// startTyping 开始或刷新房间内的正在输入状态，同一连接在同一房间 TypingMinInterval 内只转发一次
+func (client *Client) startTyping(roomId string) {
+	client.mu.Lock()
+	if timer, ok := client.typingTimers[roomId]; ok {
+		timer.Reset(constant.TypingExpire)
+	} else {
+		client.typingTimers[roomId] = time.AfterFunc(constant.TypingExpire, func() { client.expireTyping(roomId) })
+	}
+	now := time.Now()
+	forward := now.Sub(client.lastTypingAt[roomId]) >= constant.TypingMinInterval
+	if forward {
+		client.lastTypingAt[roomId] = now
+	}
+	client.mu.Unlock()
+
+	if forward {
+		client.broadcastTyping(roomId, constant.TypingActionStart)
+	}
+}
+
+// stopTyping 结束房间内的正在输入状态，没有在输入时不广播
+func (client *Client) stopTyping(roomId string) {
+	client.mu.Lock()
+	timer, typing := client.typingTimers[roomId]
+	if typing {
+		timer.Stop()
+		delete(client.typingTimers, roomId)
+	}
+	client.mu.Unlock()
+
+	if typing {
+		client.broadcastTyping(roomId, constant.TypingActionStop)
+	}
+}
+
+// expireTyping 正在输入状态超时没有刷新，自动结束
+func (client *Client) expireTyping(roomId string) {
+	client.mu.Lock()
+	_, typing := client.typingTimers[roomId]
+	delete(client.typingTimers, roomId)
+	client.mu.Unlock()
+
+	if typing {
+		client.broadcastTyping(roomId, constant.TypingActionStop)
+	}
+}
+
+// broadcastTyping 向房间内的其他成员广播正在输入事件，expires_in 为接收方自动结束的毫秒数
+func (client *Client) broadcastTyping(roomId, action string) {
+	client.Manager.SendToRoomExcept(roomId, client.UserId, &WebSocketMessage{
+		Type:     constant.MessageTypeTyping,
+		RoomId:   roomId,
+		SenderId: client.UserId,
+		Content: map[string]interface{}{
+			"action":     action,
+			"expires_in": constant.TypingExpire.Milliseconds(),
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	})
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/global"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// 节点间转发的消息类型
+const (
+	clusterKindRoom       = "room"        // 房间广播
+	clusterKindUsers      = "users"       // 投递给指定用户
+	clusterKindRoomExcept = "room_except" // 投递给房间内除指定用户外的成员
+	clusterKindDisconnect = "disconnect"  // 取消用户对房间的订阅，UserIds 为空时取消所有连接的订阅
+)
+
+// clusterEnvelope 节点间转发的消息，NodeId 为发布消息的节点，本节点发布的消息已在本地投递过，收到后忽略
+type clusterEnvelope struct {
+	NodeId        string            `json:"node_id"`
+	Kind          string            `json:"kind"`
+	RoomId        string            `json:"room_id,omitempty"`
+	UserIds       []string          `json:"user_ids,omitempty"`
+	ExcludeUserId string            `json:"exclude_user_id,omitempty"`
+	Message       *WebSocketMessage `json:"message,omitempty"`
+}
+
+// SendToUsers 将消息投递给指定用户在所有节点上的连接，不区分连接所在的房间，也不做持久化
+func (manager *WebSocketManager) SendToUsers(message *WebSocketMessage, userIds ...string) {
+	manager.sendToUsersLocal(message, userIds...)
+	for _, userId := range userIds {
+		manager.publish(userChannel(userId), &clusterEnvelope{Kind: clusterKindUsers, UserIds: []string{userId}, Message: message})
+	}
+}
+
+// SendToRoomExcept 将消息投递给所有节点上房间内除指定用户外的连接，不做持久化
+func (manager *WebSocketManager) SendToRoomExcept(roomId, excludeUserId string, message *WebSocketMessage) {
+	manager.sendToRoomExceptLocal(roomId, excludeUserId, message)
+	manager.publish(roomChannel(roomId), &clusterEnvelope{Kind: clusterKindRoomExcept, RoomId: roomId, ExcludeUserId: excludeUserId, Message: message})
+}
+
+// DisconnectUserFromRoom 取消用户在所有节点上的连接对指定房间的订阅，用于退出房间或被移出房间
+func (manager *WebSocketManager) DisconnectUserFromRoom(userId, roomId string) {
+	manager.disconnectLocal(userId, roomId)
+	manager.publish(roomChannel(roomId), &clusterEnvelope{Kind: clusterKindDisconnect, RoomId: roomId, UserIds: []string{userId}})
+}
+
+// DisconnectRoom 取消所有节点上的连接对指定房间的订阅，用于删除房间
+func (manager *WebSocketManager) DisconnectRoom(roomId string) {
+	manager.disconnectLocal("", roomId)
+	manager.publish(roomChannel(roomId), &clusterEnvelope{Kind: clusterKindDisconnect, RoomId: roomId})
+}
+
+// sendToRoomLocked 将消息投递给本节点房间内的所有连接，调用方需要持有锁
+// 缓冲区已满时只丢弃这条消息，客户端根据序号发现缺失后通过 resync 补发
+func (manager *WebSocketManager) sendToRoomLocked(roomId string, message *WebSocketMessage) {
+	for client := range manager.Rooms[roomId] {
+		select {
+		case client.Send <- message:
+		default:
+			global.CHAT_LOG.Warn("BroadcastToRoom 客户端发送缓冲区已满，消息已丢弃", "user_id", client.UserId, "room_id", roomId, "seq", message.Seq)
+		}
+	}
+}
+
+// publish 把消息发布给其他节点，失败时只记录日志，本节点的投递不受影响
+func (manager *WebSocketManager) publish(channel string, envelope *clusterEnvelope) {
+	envelope.NodeId = manager.NodeId
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		global.CHAT_LOG.Error("WebSocket publish----->编码节点消息失败", "err", err)
+		return
+	}
+	if err := global.CHAT_REDIS.Publish(context.Background(), channel, payload).Err(); err != nil {
+		global.CHAT_LOG.Error("WebSocket publish----->发布节点消息失败", "channel", channel, "err", err)
+	}
+}
+
+// receiveCluster 接收其他节点转发的消息并投递给本节点的连接
+func (manager *WebSocketManager) receiveCluster(ctx context.Context) {
+	for {
+		msg, err := manager.pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// 连接断开时 go-redis 会自动重连并恢复订阅
+			global.CHAT_LOG.Error("WebSocket receiveCluster----->接收节点消息失败", "err", err)
+			continue
+		}
+		var envelope clusterEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+			global.CHAT_LOG.Error("WebSocket receiveCluster----->解析节点消息失败", "err", err, "channel", msg.Channel)
+			continue
+		}
+		if envelope.NodeId == manager.NodeId {
+			continue
+		}
+		switch envelope.Kind {
+		case clusterKindRoom:
+			manager.mu.Lock()
+			manager.sendToRoomLocked(envelope.RoomId, envelope.Message)
+			manager.mu.Unlock()
+		case clusterKindUsers:
+			manager.sendToUsersLocal(envelope.Message, envelope.UserIds...)
+		case clusterKindRoomExcept:
+			manager.sendToRoomExceptLocal(envelope.RoomId, envelope.ExcludeUserId, envelope.Message)
+		case clusterKindDisconnect:
+			if len(envelope.UserIds) == 0 {
+				manager.disconnectLocal("", envelope.RoomId)
+			}
+			for _, userId := range envelope.UserIds {
+				manager.disconnectLocal(userId, envelope.RoomId)
+			}
+		default:
+			global.CHAT_LOG.Warn("WebSocket receiveCluster----->未知的节点消息类型", "kind", envelope.Kind)
+		}
+	}
+}
+
+// updateSubscriptions 房间或用户在本节点有第一个连接时订阅对应频道，最后一个连接断开时取消订阅
+func (manager *WebSocketManager) updateSubscriptions(ctx context.Context, subscribe bool, channels ...string) {
+	if len(channels) == 0 {
+		return
+	}
+	var err error
+	if subscribe {
+		err = manager.pubsub.Subscribe(ctx, channels...)
+	} else {
+		err = manager.pubsub.Unsubscribe(ctx, channels...)
+	}
+	if err != nil {
+		global.CHAT_LOG.Error("WebSocket updateSubscriptions----->更新节点订阅失败", "channels", channels, "subscribe", subscribe, "err", err)
+	}
+}
+
+// newNodeId 读取配置的节点id，没有配置时使用主机名加随机后缀
+func newNodeId() string {
+	if nodeId := global.CHAT_CONFIG.WebSocket.NodeId; nodeId != "" {
+		return nodeId
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "node"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(suffix))
+}
+
+// roomChannel 房间消息的 pub/sub 频道
+func roomChannel(roomId string) string {
+	return fmt.Sprintf("%s:%s", constant.RoomChannelPrefix, roomId)
+}
+
+// userChannel 用户消息的 pub/sub 频道
+func userChannel(userId string) string {
+	return fmt.Sprintf("%s:%s", constant.UserChannelPrefix, userId)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"chat-server/constant"
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Codec WebSocket 帧的编解码器，连接建立时通过 Sec-WebSocket-Protocol 协商，ReadPump 和 WritePump 共用
+type Codec interface {
+	// Subprotocol 协商使用的子协议名
+	Subprotocol() string
+	// FrameType 发送的帧类型，websocket.TextMessage 或 websocket.BinaryMessage
+	FrameType() int
+	Encode(message *WebSocketMessage) ([]byte, error)
+	Decode(data []byte, message *WebSocketMessage) error
+}
+
+// Subprotocols 服务端支持的子协议，客户端同时请求多个时按客户端的顺序选择
+func Subprotocols() []string {
+	return []string{constant.SubprotocolMsgpack, constant.SubprotocolJSON}
+}
+
+// codecFor 根据协商结果选择编解码器，没有协商子协议时使用 JSON
+func codecFor(subprotocol string) Codec {
+	if subprotocol == constant.SubprotocolMsgpack {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+// jsonCodec JSON 文本帧
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return constant.SubprotocolJSON }
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Encode(message *WebSocketMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonCodec) Decode(data []byte, message *WebSocketMessage) error {
+	return json.Unmarshal(data, message)
+}
+
+// msgpackHandle MessagePack 编解码配置，map 解码为 map[string]interface{}，和 JSON 解码的结果一致
+var msgpackHandle = func() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	handle.WriteExt = true
+	return handle
+}()
+
+// msgpackCodec MessagePack 二进制帧，字段名和 JSON 相同
+type msgpackCodec struct{}
+
+func (msgpackCodec) Subprotocol() string { return constant.SubprotocolMsgpack }
+
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Encode(message *WebSocketMessage) ([]byte, error) {
+	// content 中可能有自定义 JSON 编码的类型(如 ObjectID 编码为十六进制字符串)，先按 JSON 规则转换为基础类型，
+	// 保证两种编码的字段和取值一致
+	frame := *message
+	content, err := toPlainValue(frame.Content)
+	if err != nil {
+		return nil, err
+	}
+	frame.Content = content
+	var data []byte
+	err = codec.NewEncoderBytes(&data, msgpackHandle).Encode(&frame)
+	return data, err
+}
+
+func (msgpackCodec) Decode(data []byte, message *WebSocketMessage) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(message)
+}
+
+// toPlainValue 把任意值按 JSON 规则转换为 map、slice、字符串、数字等基础类型，整数保持为整数
+func toPlainValue(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil, string, bool, int, int64, float64:
+		return value, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var plain interface{}
+	if err := decoder.Decode(&plain); err != nil {
+		return nil, err
+	}
+	return convertNumbers(plain), nil
+}
+
+// convertNumbers 把 json.Number 转换为 int64 或 float64
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
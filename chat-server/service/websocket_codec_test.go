@@ -0,0 +1,158 @@
+package service
+
+import (
+	"chat-server/constant"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCodecFor(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		want        string
+		frameType   int
+	}{
+		{subprotocol: constant.SubprotocolMsgpack, want: constant.SubprotocolMsgpack, frameType: websocket.BinaryMessage},
+		{subprotocol: constant.SubprotocolJSON, want: constant.SubprotocolJSON, frameType: websocket.TextMessage},
+		{subprotocol: "", want: constant.SubprotocolJSON, frameType: websocket.TextMessage},
+		{subprotocol: "chat.v2.unknown", want: constant.SubprotocolJSON, frameType: websocket.TextMessage},
+	}
+	for _, tt := range tests {
+		codec := codecFor(tt.subprotocol)
+		if codec.Subprotocol() != tt.want || codec.FrameType() != tt.frameType {
+			t.Errorf("codecFor(%q) = %s/%d, want %s/%d", tt.subprotocol, codec.Subprotocol(), codec.FrameType(), tt.want, tt.frameType)
+		}
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	messageId := bson.NewObjectID()
+	tests := []struct {
+		name    string
+		message *WebSocketMessage
+		// want 为解码后的消息，content 按 JSON 规则转换为基础类型
+		want *WebSocketMessage
+	}{
+		{
+			name: "文本消息",
+			message: &WebSocketMessage{
+				ID: messageId.Hex(), Type: constant.MessageTypeText, RoomId: "room", SenderId: "user",
+				Content:   map[string]interface{}{"text": "你好"},
+				CreatedAt: 1700000000000, Seq: 42, ClientMsgId: "c1", Version: constant.ProtocolVersion, RequestId: "r1",
+			},
+			want: &WebSocketMessage{
+				ID: messageId.Hex(), Type: constant.MessageTypeText, RoomId: "room", SenderId: "user",
+				Content:   map[string]interface{}{"text": "你好"},
+				CreatedAt: 1700000000000, Seq: 42, ClientMsgId: "c1", Version: constant.ProtocolVersion, RequestId: "r1",
+			},
+		},
+		{
+			name: "嵌套内容中的整数、小数、布尔和空值",
+			message: &WebSocketMessage{
+				Type: constant.MessageTypeAck, RoomId: "room", SenderId: "user",
+				Content: map[string]interface{}{
+					"seq":       int64(7),
+					"duplicate": false,
+					"ratio":     0.5,
+					"missing":   nil,
+					"nested":    map[string]interface{}{"ids": []interface{}{"a", "b"}, "count": 3},
+				},
+			},
+			want: &WebSocketMessage{
+				Type: constant.MessageTypeAck, RoomId: "room", SenderId: "user",
+				Content: map[string]interface{}{
+					"seq":       int64(7),
+					"duplicate": false,
+					"ratio":     0.5,
+					"missing":   nil,
+					"nested":    map[string]interface{}{"ids": []interface{}{"a", "b"}, "count": int64(3)},
+				},
+			},
+		},
+		{
+			name: "ObjectID 编码为十六进制字符串",
+			message: &WebSocketMessage{
+				Type: constant.MessageTypeThread, RoomId: "room", SenderId: "user",
+				Content: struct {
+					ParentId bson.ObjectID `json:"parent_id"`
+				}{ParentId: messageId},
+			},
+			want: &WebSocketMessage{
+				Type: constant.MessageTypeThread, RoomId: "room", SenderId: "user",
+				Content: map[string]interface{}{"parent_id": messageId.Hex()},
+			},
+		},
+		{
+			name: "batch 帧中的消息列表",
+			message: &WebSocketMessage{
+				Type: constant.MessageTypeBatch, SenderId: "user",
+				Content: []WebSocketMessage{
+					{Type: constant.MessageTypeText, RoomId: "room", Content: map[string]interface{}{"text": "a"}, Seq: 1},
+					{Type: constant.MessageTypeText, RoomId: "room", Content: map[string]interface{}{"text": "b"}, Seq: 2},
+				},
+			},
+			want: &WebSocketMessage{
+				Type: constant.MessageTypeBatch, SenderId: "user",
+				Content: []interface{}{
+					map[string]interface{}{"type": constant.MessageTypeText, "room_id": "room", "sender_id": "", "content": map[string]interface{}{"text": "a"}, "created_at": int64(0), "seq": int64(1)},
+					map[string]interface{}{"type": constant.MessageTypeText, "room_id": "room", "sender_id": "", "content": map[string]interface{}{"text": "b"}, "created_at": int64(0), "seq": int64(2)},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, codec := range []Codec{jsonCodec{}, msgpackCodec{}} {
+			t.Run(tt.name+"/"+codec.Subprotocol(), func(t *testing.T) {
+				data, err := codec.Encode(tt.message)
+				if err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+				var decoded WebSocketMessage
+				if err := codec.Decode(data, &decoded); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				decoded.Content = normalizeNumbers(decoded.Content)
+				if !reflect.DeepEqual(&decoded, tt.want) {
+					t.Errorf("round trip = %#v, want %#v", decoded, *tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMsgpackEncodeKeepsMessage(t *testing.T) {
+	content := struct {
+		ParentId bson.ObjectID `json:"parent_id"`
+	}{ParentId: bson.NewObjectID()}
+	message := &WebSocketMessage{Type: constant.MessageTypeThread, Content: content}
+	if _, err := (msgpackCodec{}).Encode(message); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if message.Content != content {
+		t.Errorf("Encode() 修改了原消息的 content: %#v", message.Content)
+	}
+}
+
+// normalizeNumbers 把两种编码解码出的数字统一为 int64 或 float64，JSON 解码的整数是 float64，MessagePack 解码的整数可能是 uint64
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case uint64:
+		return int64(v)
+	}
+	return value
+}
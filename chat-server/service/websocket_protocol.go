@@ -0,0 +1,91 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"errors"
+	"time"
+)
+
+// ackRequest 请求处理成功后向发送连接回复 ack，客户端没有传请求id时不回复
+func (client *Client) ackRequest(wsMessage *WebSocketMessage) {
+	if wsMessage.RequestId == "" {
+		return
+	}
+	client.Manager.SendToClient(client, &WebSocketMessage{
+		Type:      constant.MessageTypeAck,
+		RoomId:    wsMessage.RoomId,
+		SenderId:  client.UserId,
+		RequestId: wsMessage.RequestId,
+		Content: map[string]interface{}{
+			"type": wsMessage.Type,
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	})
+}
+
+// SendError 请求处理失败时向发送连接回复 error 帧，没有请求id时也回复，客户端根据 type 和 client_msg_id 对应请求
+func (client *Client) SendError(wsMessage *WebSocketMessage, err error) {
+	client.Manager.SendToClient(client, newErrorMessage(wsMessage, client.UserId, err))
+}
+
+// newErrorMessage 构造 error 帧，content 中 code 为与 HTTP 接口一致的错误码，非业务错误统一为 ERROR
+func newErrorMessage(wsMessage *WebSocketMessage, userId string, err error) *WebSocketMessage {
+	responseCode := common.ERROR
+	var serviceErr common.ServiceErr
+	if errors.As(err, &serviceErr) {
+		responseCode = serviceErr.GetResponseCode()
+	}
+	return &WebSocketMessage{
+		Type:        constant.MessageTypeError,
+		RoomId:      wsMessage.RoomId,
+		SenderId:    userId,
+		RequestId:   wsMessage.RequestId,
+		ClientMsgId: wsMessage.ClientMsgId,
+		Content: map[string]interface{}{
+			"code": responseCode.Code,
+			"msg":  responseCode.Msg,
+			"type": wsMessage.Type,
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}
+}
+
+// writeFrames 发送多条消息，只有一条时单独成帧，多条时合并为一个 batch 帧，content 为按顺序排列的消息
+func (client *Client) writeFrames(messages []*WebSocketMessage) error {
+	switch len(messages) {
+	case 0:
+		return nil
+	case 1:
+		return client.writeFrame(messages[0])
+	}
+	frames := make([]WebSocketMessage, 0, len(messages))
+	for _, message := range messages {
+		frames = append(frames, versionedFrame(message))
+	}
+	return client.writeFrame(&WebSocketMessage{
+		Type:      constant.MessageTypeBatch,
+		SenderId:  client.UserId,
+		Content:   frames,
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	})
+}
+
+// writeFrame 按协商的编码直接向连接写入一帧，只能在 WritePump 所在的协程中调用
+func (client *Client) writeFrame(message *WebSocketMessage) error {
+	frame := versionedFrame(message)
+	data, err := client.codec.Encode(&frame)
+	if err != nil {
+		return err
+	}
+	client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return client.Conn.WriteMessage(client.codec.FrameType(), data)
+}
+
+// versionedFrame 复制消息并填写协议版本，同一条消息会投递给多个连接，不修改原消息
+func versionedFrame(message *WebSocketMessage) WebSocketMessage {
+	frame := *message
+	frame.Version = constant.ProtocolVersion
+	return frame
+}
@@ -4,59 +4,113 @@ import (
 	"chat-server/constant"
 	"chat-server/global"
 	"chat-server/model"
+	"chat-server/model/common"
 	"chat-server/utils"
 	"context"
-	"encoding/json"
-	"fmt"
+	"hash/fnv"
 	"sync"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 // WebSocket消息结构
 type WebSocketMessage struct {
+	ID        string      `json:"_id,omitempty"` // 持久化消息的id，由服务端生成
 	Type      string      `json:"type"`
 	RoomId    string      `json:"room_id"`
 	SenderId  string      `json:"sender_id"`
 	Content   interface{} `json:"content"`
 	CreatedAt int64       `json:"created_at"`
+	// 持久化消息在房间内的序号，客户端发现序号不连续时发送 resync 补发
+	Seq int64 `json:"seq,omitempty"`
+	// 客户端生成的幂等键，重复发送同一个键的消息只保存一次，持久化后通过 ack 回传
+	ClientMsgId string `json:"client_msg_id,omitempty"`
+	// 协议版本，客户端不传时视为当前版本，服务端发送时统一填写
+	Version int `json:"version,omitempty"`
+	// 客户端生成的请求id，服务端回复的 ack 或 error 帧中原样带回
+	RequestId string `json:"request_id,omitempty"`
+
+	origin      *Client // 发送消息的连接，用于回传 ack
+	replaySince int64   // 大于0时为订阅房间后的补发标记，WritePump 收到后补发该序号之后的消息
 }
 
-// 客户端
+// 客户端，一个连接可以订阅多个房间，订阅关系由管理器维护
 type Client struct {
 	Conn     *websocket.Conn
 	UserId   string
-	RoomId   string
 	Send     chan *WebSocketMessage
 	LastPing time.Time
 	Manager  *WebSocketManager
 	mu       sync.Mutex
+	// 每个房间的正在输入状态，typingTimers 中有房间表示正在输入
+	typingTimers map[string]*time.Timer
+	lastTypingAt map[string]time.Time
+	registered   chan struct{} // 注册完成后关闭
+	connId       string        // 连接id，用于区分同一用户的多个连接的在线状态
+	codec        Codec         // 连接建立时协商的编解码器
+}
+
+// NewClient 创建客户端，注册后通过 Subscribe 或订阅帧订阅房间
+func NewClient(conn *websocket.Conn, userId string, manager *WebSocketManager) *Client {
+	return &Client{
+		Conn:         conn,
+		UserId:       userId,
+		Send:         make(chan *WebSocketMessage, 256),
+		LastPing:     time.Now(),
+		Manager:      manager,
+		typingTimers: make(map[string]*time.Timer),
+		lastTypingAt: make(map[string]time.Time),
+		registered:   make(chan struct{}),
+		connId:       bson.NewObjectID().Hex(),
+		codec:        codecFor(conn.Subprotocol()),
+	}
 }
 
 // WebSocket管理器
 type WebSocketManager struct {
-	Rooms      map[string]map[*Client]bool
-	Clients    map[string][]*Client // 按用户ID组织的客户端映射（一个用户可能有多个连接，多平台）
-	Broadcast  chan *WebSocketMessage
-	Register   chan *Client
-	Unregister chan *Client
-	mu         sync.Mutex
+	Rooms         map[string]map[*Client]bool // 按房间ID组织的订阅了该房间的客户端
+	Clients       map[string][]*Client        // 按用户ID组织的客户端映射（一个用户可能有多个连接，多平台）
+	Subscriptions map[*Client]map[string]bool // 每个连接订阅的房间，连接注销后删除
+	Broadcast     chan *WebSocketMessage
+	Register      chan *Client
+	Unregister    chan *Client
+	mu            sync.Mutex
+	// 多节点部署时区分消息来源的节点id，节点之间通过 Redis pub/sub 转发消息
+	NodeId string
+	pubsub *redis.PubSub
+	// 房间广播锁，同一房间的广播依次执行
+	roomLocks [roomLockCount]sync.Mutex
 }
 
+// roomLockCount 房间广播锁的数量
+const roomLockCount = 256
+
 // NewWebSocketManager 创建一个新的WebSocket管理器
 func NewWebSocketManager() *WebSocketManager {
 	return &WebSocketManager{
-		Rooms:      make(map[string]map[*Client]bool),
-		Clients:    make(map[string][]*Client),
-		Broadcast:  make(chan *WebSocketMessage),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+		Rooms:         make(map[string]map[*Client]bool),
+		Clients:       make(map[string][]*Client),
+		Subscriptions: make(map[*Client]map[string]bool),
+		Broadcast:     make(chan *WebSocketMessage),
+		Register:      make(chan *Client),
+		Unregister:    make(chan *Client),
+		NodeId:        newNodeId(),
 	}
 }
 
 func (manager *WebSocketManager) Run(ctx context.Context) {
+	// 订阅其他节点转发的消息，本节点有连接的房间和用户才订阅
+	manager.pubsub = global.CHAT_REDIS.Subscribe(ctx)
+	defer manager.pubsub.Close()
+	go manager.receiveCluster(ctx)
+	global.CHAT_LOG.Info("WebSocket管理器已启动", "node_id", manager.NodeId)
+	// 定期清理本节点房间内过期的在线状态
+	sweepTicker := time.NewTicker(constant.PresenceSweepInterval)
+	defer sweepTicker.Stop()
+
 	for {
 		select {
 		// 接收关闭信号
@@ -66,57 +120,28 @@ func (manager *WebSocketManager) Run(ctx context.Context) {
 		// 注册用户
 		case client := <-manager.Register:
 			manager.mu.Lock()
-			// 判断房间是否存在
-			if _, ok := manager.Rooms[client.RoomId]; !ok {
-				manager.Rooms[client.RoomId] = make(map[*Client]bool)
-			}
-			// 添加客户端
-			manager.Rooms[client.RoomId][client] = true
-			// 将客户端添加到用户映射
+			// 将客户端添加到用户映射，房间在订阅时添加
+			newUser := len(manager.Clients[client.UserId]) == 0
 			manager.Clients[client.UserId] = append(manager.Clients[client.UserId], client)
+			manager.Subscriptions[client] = make(map[string]bool)
 			manager.mu.Unlock()
-
-			// 发送加入消息
-			joinMsg := &WebSocketMessage{
-				Type:      constant.MessageTypeJoin,
-				RoomId:    client.RoomId,
-				SenderId:  client.UserId,
-				Content:   map[string]interface{}{constant.MessageTypeJoin: constant.JoinMessageContent, constant.MessageTypeLeave: nil, constant.MessageTypeSystem: nil},
-				CreatedAt: utils.GetUTCMillisTimestamp(),
-			}
-			manager.BroadcastToRoom(client.RoomId, joinMsg)
-
-			// 将用户加入到redis
-			pipeline := global.CHAT_REDIS.TxPipeline()
-			ctx := context.Background()
-			cacheKey := fmt.Sprintf("online_users:%s", client.RoomId)
-			addCmd := pipeline.SAdd(ctx, cacheKey, client.UserId)
-			expireCmd := pipeline.Expire(ctx, cacheKey, constant.OnlineUserExpire)
-			if _, err := pipeline.Exec(ctx); err != nil {
-				global.CHAT_LOG.Error("WebSocket Run----->添加在线用户失败", "err", err.Error())
-				return
-			}
-			if err := addCmd.Err(); err != nil {
-				global.CHAT_LOG.Error("WebSocket Run----->添加在线用户失败", "err", err.Error())
-				return
-			}
-			if err := expireCmd.Err(); err != nil {
-				global.CHAT_LOG.Error("WebSocket Run----->添加在线用户过期时间失败", "err", err.Error())
-				return
+			if newUser {
+				manager.updateSubscriptions(ctx, true, userChannel(client.UserId))
 			}
+			close(client.registered)
 		// 注销用户
 		case client := <-manager.Unregister:
 			manager.mu.Lock()
-			// 从房间中移除客户端
-			if _, roomExist := manager.Rooms[client.RoomId]; roomExist {
-				if _, clientExist := manager.Rooms[client.RoomId][client]; clientExist {
-					delete(manager.Rooms[client.RoomId], client)
-					close(client.Send)
-					// 房间没人则删除房间
-					if len(manager.Rooms[client.RoomId]) == 0 {
-						delete(manager.Rooms, client.RoomId)
+			// 从订阅的所有房间中移除客户端
+			var channels []string
+			if rooms, exists := manager.Subscriptions[client]; exists {
+				for roomId := range rooms {
+					if manager.removeFromRoomLocked(client, roomId) {
+						channels = append(channels, roomChannel(roomId))
 					}
 				}
+				delete(manager.Subscriptions, client)
+				close(client.Send)
 			}
 
 			// 从用户映射中移除客户端
@@ -130,46 +155,132 @@ func (manager *WebSocketManager) Run(ctx context.Context) {
 				// 客户端全部离线
 				if len(newClients) == 0 {
 					delete(manager.Clients, client.UserId)
-					// 从redis中移除用户
-					cacheKey := fmt.Sprintf("online_users:%s", client.RoomId)
-					global.CHAT_REDIS.SRem(context.Background(), cacheKey, client.UserId)
+					channels = append(channels, userChannel(client.UserId))
 				} else {
 					manager.Clients[client.UserId] = newClients
 				}
 			}
 			manager.mu.Unlock()
-
-			// 发送离线消息
-			leaveMsg := &WebSocketMessage{
-				Type:      constant.MessageTypeLeave,
-				RoomId:    client.RoomId,
-				SenderId:  client.UserId,
-				Content:   map[string]interface{}{constant.MessageTypeLeave: constant.LeaveMessageContent, constant.MessageTypeJoin: nil, constant.MessageTypeSystem: nil},
-				CreatedAt: utils.GetUTCMillisTimestamp(),
-			}
-			manager.BroadcastToRoom(client.RoomId, leaveMsg)
+			manager.updateSubscriptions(ctx, false, channels...)
 		// 广播消息
 		case message := <-manager.Broadcast:
-			manager.BroadcastToRoom(message.RoomId, message)
+			if err := manager.BroadcastToRoom(message.RoomId, message); err != nil {
+				global.CHAT_LOG.Error("WebSocket管理器广播消息失败", "room_id", message.RoomId, "type", message.Type, "err", err)
+			}
+		// 清理过期的在线状态
+		case <-sweepTicker.C:
+			go manager.sweepPresence(manager.localRooms())
 		}
 	}
 }
 
-func (manager *WebSocketManager) BroadcastToRoom(roomId string, message *WebSocketMessage) {
+// disconnectLocal 取消用户在本节点的连接对指定房间的订阅，连接本身保持，订阅的其他房间不受影响
+// userId 为空时取消房间内所有连接的订阅
+func (manager *WebSocketManager) disconnectLocal(userId, roomId string) {
+	manager.mu.Lock()
+	var clients []*Client
+	for client := range manager.Rooms[roomId] {
+		if userId == "" || client.UserId == userId {
+			clients = append(clients, client)
+		}
+	}
+	manager.mu.Unlock()
+
+	for _, client := range clients {
+		manager.unsubscribe(client, roomId)
+	}
+}
+
+// sendToUsersLocal 将消息投递给指定用户在本节点的所有连接，不区分连接所在的房间，也不做持久化
+func (manager *WebSocketManager) sendToUsersLocal(message *WebSocketMessage, userIds ...string) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	// 向指定房间发送消息
-	if clients, exists := manager.Rooms[roomId]; exists {
-		for client := range clients {
+	for _, userId := range userIds {
+		for _, client := range manager.Clients[userId] {
+			// 已注销的客户端发送通道已关闭，跳过
+			if manager.Subscriptions[client] == nil {
+				continue
+			}
 			select {
 			case client.Send <- message:
 			default:
-				close(client.Send)
-				delete(manager.Rooms[roomId], client)
+				global.CHAT_LOG.Warn("SendToUsers 客户端发送缓冲区已满，消息已丢弃", "user_id", userId, "type", message.Type)
 			}
 		}
 	}
+}
+
+// SendToClient 将消息投递给指定连接，连接已注销时丢弃
+func (manager *WebSocketManager) SendToClient(client *Client, message *WebSocketMessage) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.sendToClientLocked(client, message)
+}
+
+// sendToClientLocked 将消息投递给指定连接，调用方需要持有锁
+func (manager *WebSocketManager) sendToClientLocked(client *Client, message *WebSocketMessage) {
+	// 已注销的客户端发送通道已关闭，跳过
+	if manager.Subscriptions[client] == nil {
+		return
+	}
+	select {
+	case client.Send <- message:
+	default:
+		global.CHAT_LOG.Warn("SendToClient 客户端发送缓冲区已满，消息已丢弃", "user_id", client.UserId, "room_id", message.RoomId, "type", message.Type)
+	}
+}
+
+// sendToRoomExceptLocal 将消息投递给本节点房间内除指定用户外的所有连接，不做持久化
+func (manager *WebSocketManager) sendToRoomExceptLocal(roomId, excludeUserId string, message *WebSocketMessage) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	for client := range manager.Rooms[roomId] {
+		if client.UserId == excludeUserId {
+			continue
+		}
+		select {
+		case client.Send <- message:
+		default:
+			global.CHAT_LOG.Warn("SendToRoomExcept 客户端发送缓冲区已满，消息已丢弃", "user_id", client.UserId, "room_id", roomId)
+		}
+	}
+}
+
+// NewSystemMessage 构造系统消息(加入、离开、系统通知)，content中只有对应类型的字段有值
+func NewSystemMessage(messageType, roomId, senderId, text string) *WebSocketMessage {
+	content := map[string]interface{}{
+		constant.MessageTypeJoin:   nil,
+		constant.MessageTypeLeave:  nil,
+		constant.MessageTypeSystem: nil,
+	}
+	content[messageType] = text
+	return &WebSocketMessage{
+		Type:      messageType,
+		RoomId:    roomId,
+		SenderId:  senderId,
+		Content:   content,
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}
+}
+
+// BroadcastToRoom 向房间广播消息，用户消息和系统消息分配id和序号后持久化，分配序号失败时返回错误，消息不投递
+func (manager *WebSocketManager) BroadcastToRoom(roomId string, message *WebSocketMessage) error {
+	err := manager.sequenceAndDeliver(roomId, message, func() error {
+		// 向本节点的房间成员发送消息，再通过 Redis 转发给其他节点
+		// 其他节点只投递不持久化，消息只在接收它的节点保存一次
+		manager.mu.Lock()
+		manager.sendToRoomLocked(roomId, message)
+		manager.mu.Unlock()
+		manager.publish(roomChannel(roomId), &clusterEnvelope{Kind: clusterKindRoom, RoomId: roomId, Message: message})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	messageId, _ := bson.ObjectIDFromHex(message.ID)
 
 	// 保存用户消息到mongoDB
 	if constant.UserMessageType[message.Type] {
@@ -181,15 +292,28 @@ func (manager *WebSocketManager) BroadcastToRoom(roomId string, message *WebSock
 			}
 			// 保存消息到mongoDB
 			mongoMsg := model.UserMessages{
-				ID:        bson.NewObjectID(),
+				ID:        messageId,
 				RoomId:    message.RoomId,
 				SenderId:  message.SenderId,
 				Type:      message.Type,
 				Content:   content,
 				CreatedAt: message.CreatedAt,
+				Seq:       message.Seq,
 			}
 			if _, err := global.CHAT_MONGODB.Collection("user_messages").InsertOne(context.Background(), mongoMsg); err != nil {
 				global.CHAT_LOG.Error("WebSocket BroadcastToRoom----->保存消息到MongoDB失败", "err", err.Error())
+				// 释放幂等键，客户端没有收到 ack 重发时可以重新保存
+				releaseClientMsgId(message)
+				if message.origin != nil {
+					manager.SendToClient(message.origin, newErrorMessage(message, message.SenderId, err))
+				}
+				return
+			}
+			// 持久化后向发送者回传 ack
+			manager.ackMessage(message)
+			// 回复保存后更新所属线程
+			if mongoMsg.Type == constant.MessageTypeReply {
+				ServiceGroupApp.MessageService.onThreadReply(&mongoMsg)
 			}
 
 		}(message)
@@ -204,12 +328,13 @@ func (manager *WebSocketManager) BroadcastToRoom(roomId string, message *WebSock
 			}
 			// 保存消息到mongoDB
 			mongoMsg := model.SystemMessages{
-				ID:        bson.NewObjectID(),
+				ID:        messageId,
 				RoomId:    message.RoomId,
 				SenderId:  message.SenderId,
 				Type:      message.Type,
 				Content:   content,
 				CreatedAt: message.CreatedAt,
+				Seq:       message.Seq,
 			}
 			if _, err := global.CHAT_MONGODB.Collection("system_messages").InsertOne(context.Background(), mongoMsg); err != nil {
 				global.CHAT_LOG.Error("WebSocket BroadcastToRoom----->保存消息到MongoDB失败", "err", err.Error())
@@ -217,12 +342,58 @@ func (manager *WebSocketManager) BroadcastToRoom(roomId string, message *WebSock
 
 		}(message)
 	}
+	return nil
+}
+
+// sequenceAndDeliver 持有房间锁为消息分配id和房间序号，再调用 deliver 投递
+// 同一房间的消息依次分配序号和投递，保证各节点的投递顺序和序号一致
+// 分配序号和转发需要访问 Redis，不持有管理器的锁，其他房间不受影响
+func (manager *WebSocketManager) sequenceAndDeliver(roomId string, message *WebSocketMessage, deliver func() error) error {
+	roomLock := manager.roomLock(roomId)
+	roomLock.Lock()
+	defer roomLock.Unlock()
+
+	if err := assignRoomSeq(roomId, message); err != nil {
+		return err
+	}
+	return deliver()
+}
+
+// assignRoomSeq 为需要持久化的消息生成id和房间序号，已有合法id时沿用
+func assignRoomSeq(roomId string, message *WebSocketMessage) error {
+	if !constant.UserMessageType[message.Type] && !constant.SystemMessageType[message.Type] {
+		return nil
+	}
+	messageId, err := bson.ObjectIDFromHex(message.ID)
+	if err != nil {
+		messageId = bson.NewObjectID()
+	}
+	seq, err := nextRoomSeq(context.Background(), roomId)
+	if err != nil {
+		return err
+	}
+	message.ID = messageId.Hex()
+	message.Seq = seq
+	return nil
+}
 
+// roomLock 房间的广播锁，房间按id散列到固定数量的锁上
+func (manager *WebSocketManager) roomLock(roomId string) *sync.Mutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(roomId))
+	return &manager.roomLocks[hash.Sum32()%roomLockCount]
 }
 
 func (client *Client) ReadPump() {
-	global.CHAT_LOG.Info("ReadPump 开始读取消息")
+	global.CHAT_LOG.Info("ReadPump 开始读取消息", "subprotocol", client.codec.Subprotocol())
+	// 在线状态在读取协程中登记、刷新和移除，保证同一连接的操作按顺序执行
+	client.refreshPresence()
 	defer func() {
+		for _, roomId := range client.Manager.subscribedRooms(client) {
+			client.stopTyping(roomId)
+			client.leavePresence(roomId)
+		}
+		client.leaveUserPresence()
 		client.Manager.Unregister <- client
 		client.Conn.Close()
 		global.CHAT_LOG.Info("ReadPump 读取消息结束")
@@ -235,6 +406,7 @@ func (client *Client) ReadPump() {
 		client.LastPing = time.Now()
 		client.mu.Unlock()
 		client.Conn.SetReadDeadline(time.Now().Add(time.Second * 60))
+		client.refreshPresence(client.Manager.subscribedRooms(client)...)
 		return nil
 	})
 
@@ -248,21 +420,160 @@ func (client *Client) ReadPump() {
 			}
 			break
 		}
-		// 接收json格式的message，解析成WebSocketMessage类型。
+		// 按协商的编码解析成WebSocketMessage类型，无法解析时回复 error 帧
 		var wsMessage WebSocketMessage
-		if err := json.Unmarshal(message, &wsMessage); err != nil {
-			global.CHAT_LOG.Error("WebSocket解析消息错误", "err", err, "message", message)
-			// 解析错误则默认当作文本处理
-			wsMessage.Type = constant.MessageTypeText
-			wsMessage.Content = map[string]interface{}{"text": string(message)}
+		if err := client.codec.Decode(message, &wsMessage); err != nil {
+			global.CHAT_LOG.Warn("WebSocket解析消息错误", "err", err, "user_id", client.UserId)
+			client.SendError(&WebSocketMessage{}, common.NewServiceError(common.WS_INVALID_FRAME))
+			continue
 		}
 		// 解析后json后，设置基本信息
-		wsMessage.RoomId = client.RoomId
+		wsMessage.ID = ""
+		wsMessage.Seq = 0
+		wsMessage.origin = client
+		wsMessage.replaySince = 0
 		wsMessage.SenderId = client.UserId
 		wsMessage.CreatedAt = utils.GetUTCMillisTimestamp()
-		// 发送消息
-		client.Manager.Broadcast <- &wsMessage
+		if err := client.handleFrame(&wsMessage); err != nil {
+			global.CHAT_LOG.Warn("ReadPump 处理消息失败", "user_id", client.UserId, "room_id", wsMessage.RoomId, "type", wsMessage.Type, "err", err)
+			client.SendError(&wsMessage, err)
+		}
+	}
+}
+
+// handleFrame 处理客户端发送的一帧，返回错误时由 ReadPump 回复 error 帧
+// 不需要持久化的操作处理成功后立即 ack，用户消息在持久化后 ack
+func (client *Client) handleFrame(wsMessage *WebSocketMessage) error {
+	if wsMessage.Version > constant.ProtocolVersion {
+		return common.NewServiceError(common.WS_UNSUPPORTED_VERSION)
+	}
+	// 订阅和取消订阅房间
+	if wsMessage.Type == constant.MessageTypeSubscribe || wsMessage.Type == constant.MessageTypeUnsubscribe {
+		if err := client.handleSubscription(wsMessage); err != nil {
+			return err
+		}
+		client.ackRequest(wsMessage)
+		return nil
+	}
+	// 其他消息发往 room_id 指定的房间，只订阅了一个房间时可以省略
+	roomId, ok := client.Manager.resolveRoom(client, wsMessage.RoomId)
+	if !ok {
+		return common.NewServiceError(common.WS_NOT_SUBSCRIBED)
+	}
+	wsMessage.RoomId = roomId
+
+	var err error
+	switch {
+	// 按序号补发缺失的消息，只回复给当前连接，resync 帧即为响应
+	case wsMessage.Type == constant.MessageTypeResync:
+		return client.handleResync(wsMessage)
+	// 正在输入只转发给房间内的其他成员，不持久化
+	case wsMessage.Type == constant.MessageTypeTyping:
+		err = client.handleTyping(wsMessage)
+	// 编辑、删除消息、表情回应和已读回执由服务处理后广播事件，不直接转发
+	case messageOperationTypes[wsMessage.Type]:
+		err = client.handleMessageOperation(wsMessage)
+	case constant.UserMessageType[wsMessage.Type]:
+		return client.sendUserMessage(wsMessage)
+	// 系统消息只能由服务端发送
+	default:
+		return common.NewServiceError(common.WS_UNKNOWN_TYPE)
+	}
+	if err != nil {
+		return err
 	}
+	client.ackRequest(wsMessage)
+	return nil
+}
+
+// sendUserMessage 校验用户消息后广播，所有校验都在广播前完成，校验失败的消息不会发送到房间
+func (client *Client) sendUserMessage(wsMessage *WebSocketMessage) error {
+	// 校验发言权限(只读成员、公告房间等)
+	_, _, err := ServiceGroupApp.RoomService.CheckPermission(client.UserId, wsMessage.RoomId, constant.RoomPermissionSendMessage)
+	if err != nil {
+		return err
+	}
+	// 回复消息校验回复的消息在同一房间，并指向线程的根消息
+	if wsMessage.Type == constant.MessageTypeReply {
+		if err := client.resolveReply(wsMessage); err != nil {
+			return err
+		}
+	}
+	if _, isValid := validateUserMessage(wsMessage); !isValid {
+		return common.NewServiceError(common.MESSAGE_INVALID)
+	}
+	// 发送消息后结束正在输入状态
+	client.stopTyping(wsMessage.RoomId)
+	// 带幂等键的重复消息不再广播，直接回传之前的 ack
+	if wsMessage.ClientMsgId != "" {
+		claimed, err := client.claimClientMsgId(wsMessage)
+		if err != nil || !claimed {
+			return err
+		}
+	}
+	// 在读取协程中直接广播，同一连接的消息按发送顺序分配序号，分配序号失败时回复 error 帧
+	if err := client.Manager.BroadcastToRoom(wsMessage.RoomId, wsMessage); err != nil {
+		releaseClientMsgId(wsMessage)
+		return err
+	}
+	return nil
+}
+
+// resolveReply 把回复消息的 reply_to 替换为线程根消息的id
+func (client *Client) resolveReply(wsMessage *WebSocketMessage) error {
+	contentMap, ok := wsMessage.Content.(map[string]interface{})
+	if !ok {
+		return common.NewServiceError(common.MESSAGE_INVALID)
+	}
+	replyMap := utils.GetMapValue(contentMap, "reply")
+	if replyMap == nil {
+		return common.NewServiceError(common.MESSAGE_INVALID)
+	}
+	parentId, err := ServiceGroupApp.MessageService.ResolveThreadParent(wsMessage.RoomId, utils.GetStringValue(replyMap, "reply_to"))
+	if err != nil {
+		return err
+	}
+	replyMap["reply_to"] = parentId
+	return nil
+}
+
+// messageOperationTypes 由服务处理的消息操作类型
+var messageOperationTypes = map[string]bool{
+	constant.MessageTypeEdit:     true,
+	constant.MessageTypeDelete:   true,
+	constant.MessageTypeReaction: true,
+	constant.MessageTypeReceipt:  true,
+}
+
+// handleMessageOperation 处理编辑、删除消息、表情回应和已读回执操作，content 中 message_id 为目标消息
+// 编辑时 text 为新内容；表情回应时 emoji 为表情，action 为 add 或 remove；已读回执的目标消息必须在当前房间
+func (client *Client) handleMessageOperation(wsMessage *WebSocketMessage) error {
+	contentMap, ok := wsMessage.Content.(map[string]interface{})
+	if !ok {
+		return common.NewServiceError(common.MESSAGE_INVALID)
+	}
+	messageId := utils.GetStringValue(contentMap, "message_id")
+
+	var err error
+	switch wsMessage.Type {
+	case constant.MessageTypeEdit:
+		_, err = ServiceGroupApp.MessageService.EditMessage(client.UserId, messageId, utils.GetStringValue(contentMap, "text"))
+	case constant.MessageTypeDelete:
+		err = ServiceGroupApp.MessageService.DeleteMessage(client.UserId, messageId)
+	case constant.MessageTypeReaction:
+		emoji := utils.GetStringValue(contentMap, "emoji")
+		switch utils.GetStringValue(contentMap, "action") {
+		case constant.ReactionActionAdd:
+			_, err = ServiceGroupApp.MessageService.AddReaction(client.UserId, messageId, emoji)
+		case constant.ReactionActionRemove:
+			_, err = ServiceGroupApp.MessageService.RemoveReaction(client.UserId, messageId, emoji)
+		default:
+			err = common.NewServiceError(common.INVALID_PARAMS)
+		}
+	case constant.MessageTypeReceipt:
+		_, err = ServiceGroupApp.MessageService.MarkRead(client.UserId, wsMessage.RoomId, messageId)
+	}
+	return err
 }
 
 func (client *Client) WritePump() {
@@ -273,6 +584,9 @@ func (client *Client) WritePump() {
 		client.Conn.Close()
 	}()
 
+	// 订阅房间时带 since_seq 会先补发离线消息，补发期间该房间的实时消息在发送通道中排队，补发完成后跳过已补发的序号
+	replayedSeq := make(map[string]int64)
+
 	for {
 		select {
 		case message, ok := <-client.Send:
@@ -283,30 +597,32 @@ func (client *Client) WritePump() {
 				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			// 将消息编码为JSON
-			jsonMessage, err := json.Marshal(message)
-			if err != nil {
-				global.CHAT_LOG.Error("WritePump 编码WebSocket消息失败", "err", err)
-				return
-			}
-			// 设置websocket写入器
-			w, err := client.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				global.CHAT_LOG.Error("WritePump 设置写入器错误", "err", err)
-			}
-			w.Write(jsonMessage)
-			// 检查是否还有别的消息
-			n := len(client.Send)
-			for i := 0; i < n; i++ {
-				jsonMessage, err = json.Marshal(<-client.Send)
-				if err != nil {
-					global.CHAT_LOG.Error("WritePump 编码WebSocket消息失败", "err", err)
-					return
+			// 发送通道中已有的消息合并为一个 batch 帧，遇到补发标记时先发送已合并的消息
+			var pending []*WebSocketMessage
+			for n := len(client.Send); ; n-- {
+				if message.replaySince > 0 {
+					if err := client.writeFrames(pending); err != nil {
+						global.CHAT_LOG.Error("WritePump 发送WebSocket消息失败", "err", err)
+						return
+					}
+					pending = nil
+					lastSeq, err := client.catchUp(message.RoomId, message.replaySince)
+					if err != nil {
+						global.CHAT_LOG.Error("WritePump 补发离线消息失败", "user_id", client.UserId, "room_id", message.RoomId, "err", err)
+						return
+					}
+					replayedSeq[message.RoomId] = lastSeq
+				} else if !client.alreadyReplayed(message, replayedSeq) {
+					pending = append(pending, message)
+				}
+				// 检查是否还有别的消息
+				if n == 0 {
+					break
 				}
-				w.Write([]byte("\n"))
-				w.Write(jsonMessage)
+				message = <-client.Send
 			}
-			if err := w.Close(); err != nil {
+			if err := client.writeFrames(pending); err != nil {
+				global.CHAT_LOG.Error("WritePump 发送WebSocket消息失败", "err", err)
 				return
 			}
 		case <-ticker.C:
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"chat-server/constant"
+	"chat-server/model/common"
+	"chat-server/utils"
+	"context"
+)
+
+// Subscribe 连接订阅房间，只有房间成员可以订阅，sinceSeq 大于0时先补发序号之后的离线消息
+// 订阅成功后向连接回复 subscribe 帧，已订阅时只回复并补发
+func (manager *WebSocketManager) Subscribe(client *Client, roomId string, sinceSeq int64) error {
+	<-client.registered
+	if roomId == "" || sinceSeq < 0 {
+		return common.NewServiceError(common.INVALID_PARAMS)
+	}
+	if err := ServiceGroupApp.RoomService.CheckRoomMember(client.UserId, roomId); err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	rooms := manager.Subscriptions[client]
+	if rooms == nil {
+		// 连接已注销
+		manager.mu.Unlock()
+		return common.NewServiceError(common.ERROR)
+	}
+	if !rooms[roomId] && len(rooms) >= constant.MaxRoomSubscriptions {
+		manager.mu.Unlock()
+		return common.NewServiceError(common.SUBSCRIPTION_LIMIT)
+	}
+	newRoom := false
+	if _, ok := manager.Rooms[roomId]; !ok {
+		manager.Rooms[roomId] = make(map[*Client]bool)
+		newRoom = true
+	}
+	manager.Rooms[roomId][client] = true
+	rooms[roomId] = true
+	// 回复和补发标记在持有锁时入队，之后分配序号的实时消息一定排在补发标记之后
+	manager.sendToClientLocked(client, newSubscriptionMessage(constant.MessageTypeSubscribe, roomId, client.UserId, true))
+	if sinceSeq > 0 {
+		manager.sendToClientLocked(client, &WebSocketMessage{RoomId: roomId, replaySince: sinceSeq})
+	}
+	manager.mu.Unlock()
+
+	if newRoom {
+		manager.updateSubscriptions(context.Background(), true, roomChannel(roomId))
+	}
+	client.refreshPresence(roomId)
+	return nil
+}
+
+// unsubscribe 取消连接对房间的订阅并回复 unsubscribe 帧，用于客户端取消订阅、退出房间或被移出房间
+func (manager *WebSocketManager) unsubscribe(client *Client, roomId string) {
+	manager.mu.Lock()
+	rooms := manager.Subscriptions[client]
+	if !rooms[roomId] {
+		manager.mu.Unlock()
+		return
+	}
+	delete(rooms, roomId)
+	emptyRoom := manager.removeFromRoomLocked(client, roomId)
+	manager.sendToClientLocked(client, newSubscriptionMessage(constant.MessageTypeUnsubscribe, roomId, client.UserId, false))
+	manager.mu.Unlock()
+
+	if emptyRoom {
+		manager.updateSubscriptions(context.Background(), false, roomChannel(roomId))
+	}
+	client.stopTyping(roomId)
+	client.leavePresence(roomId)
+}
+
+// removeFromRoomLocked 把连接从房间中移除，调用方需要持有锁，返回房间在本节点是否已经没有连接
+func (manager *WebSocketManager) removeFromRoomLocked(client *Client, roomId string) bool {
+	clients, ok := manager.Rooms[roomId]
+	if !ok {
+		return false
+	}
+	delete(clients, client)
+	// 房间没人则删除房间
+	if len(clients) == 0 {
+		delete(manager.Rooms, roomId)
+		return true
+	}
+	return false
+}
+
+// subscribedRooms 连接当前订阅的房间
+func (manager *WebSocketManager) subscribedRooms(client *Client) []string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	roomIds := make([]string, 0, len(manager.Subscriptions[client]))
+	for roomId := range manager.Subscriptions[client] {
+		roomIds = append(roomIds, roomId)
+	}
+	return roomIds
+}
+
+// resolveRoom 确认消息的目标房间已被连接订阅，roomId 为空且只订阅了一个房间时使用该房间
+func (manager *WebSocketManager) resolveRoom(client *Client, roomId string) (string, bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	rooms := manager.Subscriptions[client]
+	if roomId == "" && len(rooms) == 1 {
+		for onlyRoom := range rooms {
+			return onlyRoom, true
+		}
+	}
+	return roomId, rooms[roomId]
+}
+
+// handleSubscription 处理订阅和取消订阅帧，room_id 为目标房间，订阅时 content 中 since_seq 为已收到的最后序号(可选)
+func (client *Client) handleSubscription(wsMessage *WebSocketMessage) error {
+	if wsMessage.Type == constant.MessageTypeUnsubscribe {
+		client.Manager.unsubscribe(client, wsMessage.RoomId)
+		return nil
+	}
+	var sinceSeq int64
+	if contentMap, ok := wsMessage.Content.(map[string]interface{}); ok {
+		sinceSeq = int64(utils.GetIntValue(contentMap, "since_seq"))
+	}
+	return client.Manager.Subscribe(client, wsMessage.RoomId, sinceSeq)
+}
+
+// newSubscriptionMessage 构造订阅状态帧，subscribed 为连接当前是否订阅了该房间
+func newSubscriptionMessage(messageType, roomId, userId string, subscribed bool) *WebSocketMessage {
+	return &WebSocketMessage{
+		Type:     messageType,
+		RoomId:   roomId,
+		SenderId: userId,
+		Content: map[string]interface{}{
+			"subscribed": subscribed,
+		},
+		CreatedAt: utils.GetUTCMillisTimestamp(),
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import "strings"
+
+// SplitSQLStatements 把SQL脚本拆分为单条语句并去掉注释
+// 能正确处理字符串、反引号标识符和注释中的分号，支持 -- 、# 和 /* */ 三种注释
+func SplitSQLStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	runes := []rune(script)
+	n := len(runes)
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < n; i++ {
+		c := runes[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 字符串和标识符原样保留，反斜杠转义和连续两个引号都表示引号本身
+			current.WriteRune(c)
+			for i++; i < n; i++ {
+				current.WriteRune(runes[i])
+				if runes[i] == '\\' && c != '`' && i+1 < n {
+					i++
+					current.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == c {
+					if i+1 < n && runes[i+1] == c {
+						i++
+						current.WriteRune(runes[i])
+						continue
+					}
+					break
+				}
+			}
+		case c == '#' || (c == '-' && i+2 < n && runes[i+1] == '-' && isSQLSpace(runes[i+2])) || (c == '-' && i+2 == n && runes[i+1] == '-'):
+			// 单行注释跳到行尾
+			for i < n && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+		case c == '/' && i+1 < n && runes[i+1] == '*':
+			// 块注释
+			for i += 2; i < n && !(runes[i] == '*' && i+1 < n && runes[i+1] == '/'); i++ {
+			}
+			i++
+			current.WriteRune(' ')
+		case c == ';':
+			flush()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+func isSQLSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "多条语句",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "最后一条语句没有分号",
+			script: "SELECT 1;\nSELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "空语句被忽略",
+			script: ";;\n  ;SELECT 1;;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "空脚本",
+			script: " \n\t",
+			want:   nil,
+		},
+		{
+			name:   "单引号字符串中的分号",
+			script: "INSERT INTO t VALUES ('a;b');SELECT 1;",
+			want:   []string{"INSERT INTO t VALUES ('a;b')", "SELECT 1"},
+		},
+		{
+			name:   "双引号字符串中的分号",
+			script: `INSERT INTO t VALUES ("a;b");SELECT 1;`,
+			want:   []string{`INSERT INTO t VALUES ("a;b")`, "SELECT 1"},
+		},
+		{
+			name:   "反引号标识符中的分号",
+			script: "SELECT `a;b` FROM t;SELECT 1;",
+			want:   []string{"SELECT `a;b` FROM t", "SELECT 1"},
+		},
+		{
+			name:   "反斜杠转义的引号",
+			script: `INSERT INTO t VALUES ('it\'s; ok');SELECT 1;`,
+			want:   []string{`INSERT INTO t VALUES ('it\'s; ok')`, "SELECT 1"},
+		},
+		{
+			name:   "反斜杠转义反斜杠",
+			script: `INSERT INTO t VALUES ('a\\');SELECT 1;`,
+			want:   []string{`INSERT INTO t VALUES ('a\\')`, "SELECT 1"},
+		},
+		{
+			name:   "连续两个引号表示引号本身",
+			script: "INSERT INTO t VALUES ('it''s; ok');SELECT 1;",
+			want:   []string{"INSERT INTO t VALUES ('it''s; ok')", "SELECT 1"},
+		},
+		{
+			name:   "反引号中的反斜杠不是转义",
+			script: "SELECT `a\\` FROM t;SELECT 1;",
+			want:   []string{"SELECT `a\\` FROM t", "SELECT 1"},
+		},
+		{
+			name:   "字符串中的注释符号原样保留",
+			script: "INSERT INTO t VALUES ('-- a', '# b', '/* c */');",
+			want:   []string{"INSERT INTO t VALUES ('-- a', '# b', '/* c */')"},
+		},
+		{
+			name:   "双横线注释",
+			script: "-- 建表; 注释\nSELECT 1; -- 行尾注释;\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "双横线后没有空白不是注释",
+			script: "SELECT 1--1;",
+			want:   []string{"SELECT 1--1"},
+		},
+		{
+			name:   "脚本末尾的双横线注释",
+			script: "SELECT 1;--",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "井号注释",
+			script: "# 注释; 不拆分\nSELECT 1 # 行尾注释;\n;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "块注释",
+			script: "/* 多行;\n注释 */SELECT /* 内联; */ 1;",
+			want:   []string{"SELECT   1"},
+		},
+		{
+			name:   "未结束的块注释",
+			script: "SELECT 1; /* 未结束; SELECT 2;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "注释不会连接前后的内容",
+			script: "SELECT/* c */1;SELECT 2-- c\n+1;",
+			want:   []string{"SELECT 1", "SELECT 2\n+1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitSQLStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitSQLStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}